@@ -1,8 +1,8 @@
 module github.com/LLKennedy/protoc-gen-tsjson
 
-go 1.16
+go 1.20
 
 require (
-	github.com/golang/protobuf v1.4.1
-	google.golang.org/protobuf v1.25.0
+	github.com/golang/protobuf v1.5.4
+	google.golang.org/protobuf v1.34.2
 )
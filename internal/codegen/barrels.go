@@ -0,0 +1,118 @@
+package codegen
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/LLKennedy/protoc-gen-tsjson/internal/version"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// Barrels are index.ts files re-exporting every type and client generated in this request for a directory or proto package,
+// so e.g. the package acme.billing can be imported from "@acme/protos/acme/billing" without knowing which file declares each type.
+//
+// Every name is exported as it is declared, so adding a file to a barrel never renames the exports already in it.
+// Names exported by more than one file in the same barrel, such as two packages in one directory both declaring Invoice, are reported as errors instead.
+
+const barrelName = "index"
+
+// generateBarrels creates the barrels selected by opts for the generated files, outputs are the lower case names of the generated files and the proto files generating them
+func generateBarrels(files []*descriptorpb.FileDescriptorProto, symbols symbolTable, opts options, outputs map[string]string, diags *diagnostics) (outfiles []*pluginpb.CodeGeneratorResponse_File) {
+	if opts.barrels == barrelsNone {
+		return nil
+	}
+	// Map of barrel paths to the files they re-export, a directory barrel and package barrel at the same path are merged
+	barrels := map[string][]*descriptorpb.FileDescriptorProto{}
+	add := func(barrelPath string, file *descriptorpb.FileDescriptorProto) {
+		for _, other := range barrels[barrelPath] {
+			if other == file {
+				return
+			}
+		}
+		barrels[barrelPath] = append(barrels[barrelPath], file)
+	}
+	for _, file := range files {
+		if opts.barrels == barrelsDirectory || opts.barrels == barrelsAll {
+			add(path.Join(path.Dir(getFileLocation(file, opts).importPath), barrelName), file)
+		}
+		if opts.barrels == barrelsPackage || opts.barrels == barrelsAll {
+			add(path.Join(strings.ReplaceAll(file.GetPackage(), ".", "/"), barrelName), file)
+		}
+	}
+	barrelPaths := make([]string, 0, len(barrels))
+	for barrelPath := range barrels {
+		barrelPaths = append(barrelPaths, barrelPath)
+	}
+	sort.Strings(barrelPaths)
+	for _, barrelPath := range barrelPaths {
+		if out := generateBarrel(barrelPath, barrels[barrelPath], symbols, opts, outputs, diags); out != nil {
+			outfiles = append(outfiles, out)
+		}
+	}
+	return
+}
+
+// generateBarrel creates a single barrel, nothing is returned if none of the files export anything
+func generateBarrel(barrelPath string, files []*descriptorpb.FileDescriptorProto, symbols symbolTable, opts options, outputs map[string]string, diags *diagnostics) *pluginpb.CodeGeneratorResponse_File {
+	outName := barrelPath + ".ts"
+	if other, ok := outputs[strings.ToLower(outName)]; ok {
+		diags.forFile(files[0]).add(nil, "barrel %s collides with the output file generated from %s", outName, other)
+		return nil
+	}
+	// Files are written in order of their paths, so the output is stable
+	sort.Slice(files, func(i, j int) bool {
+		return getFileLocation(files[i], opts).importPath < getFileLocation(files[j], opts).importPath
+	})
+	// Map of exported identifiers to the proto files exporting them
+	exported := map[string]*descriptorpb.FileDescriptorProto{}
+	content := &strings.Builder{}
+	sources := make([]string, 0, len(files))
+	for _, file := range files {
+		names := getExportedNames(file, symbols, opts)
+		exports := make([]string, 0, len(names))
+		for _, name := range names {
+			if other, ok := exported[name]; ok {
+				hint := ""
+				if other.GetPackage() != file.GetPackage() && opts.barrels != barrelsPackage {
+					hint = ", use barrels=package to give each package a barrel of its own"
+				}
+				diags.forFile(file).add(nil, "barrel %s would export %s from both %s and %s%s", outName, name, other.GetName(), file.GetName(), hint)
+				continue
+			}
+			exported[name] = file
+			exports = append(exports, "\n	"+name)
+		}
+		if len(exports) == 0 {
+			continue
+		}
+		sources = append(sources, file.GetName())
+		content.WriteString(fmt.Sprintf("export { %s\n} from \"%s\";\n", strings.Join(exports, ","), relativeImport(barrelPath, getFileLocation(file, opts).importPath)))
+	}
+	if len(sources) == 0 {
+		return nil
+	}
+	return &pluginpb.CodeGeneratorResponse_File{
+		Name:    proto.String(outName),
+		Content: proto.String(getCodeGenmarker(version.GetVersionString(), protocVersion, strings.Join(sources, ", ")) + content.String()),
+	}
+}
+
+// getExportedNames lists every identifier a generated file exports, sorted
+func getExportedNames(f *descriptorpb.FileDescriptorProto, symbols symbolTable, opts options) (names []string) {
+	for _, s := range symbols {
+		if s.file == f.GetName() && s.kind != symbolMapEntry {
+			names = append(names, s.localName)
+		}
+	}
+	if opts.services {
+		for _, service := range f.GetService() {
+			names = append(names, getClientName(service))
+		}
+	}
+	sort.Strings(names)
+	return
+}
@@ -0,0 +1,74 @@
+package codegen
+
+import "testing"
+
+// barrelFile is a text format proto3 file in npm package acme declaring one message, generated at the import path
+func barrelFile(name, protoPackage, importPath, message string) string {
+	return `name: "` + name + `" package: "` + protoPackage + `" syntax: "proto3"
+options { [tsjson.npm_package]: "acme" [tsjson.import_path]: "` + importPath + `" }
+message_type { name: "` + message + `" }`
+}
+
+func TestPackageBarrels(t *testing.T) {
+	generated, err := generate(t, "barrels=package",
+		barrelFile("a.proto", "acme.billing", "gen/a", "Invoice"),
+		barrelFile("b.proto", "acme.shop", "gen/b", "Invoice"),
+	)
+	if err != nil {
+		t.Fatalf("generation failed: %v", err)
+	}
+	assertContains(t, generated["acme/billing/index.ts"], "export { \n\tInvoice\n} from \"../../gen/a\";")
+	assertContains(t, generated["acme/shop/index.ts"], "export { \n\tInvoice\n} from \"../../gen/b\";")
+	if _, ok := generated["gen/index.ts"]; ok {
+		t.Errorf("gen/index.ts was generated without directory barrels")
+	}
+}
+
+func TestBarrelCollisions(t *testing.T) {
+	tests := []struct {
+		name        string
+		parameter   string
+		files       []string
+		diagnostics []string
+	}{
+		{
+			name:      "same name from different packages",
+			parameter: "barrels=directory",
+			files: []string{
+				barrelFile("a.proto", "acme.billing", "gen/a", "Invoice"),
+				barrelFile("b.proto", "acme.shop", "gen/b", "Invoice"),
+			},
+			diagnostics: []string{"b.proto: barrel gen/index.ts would export Invoice from both a.proto and b.proto, use barrels=package to give each package a barrel of its own"},
+		},
+		{
+			name:      "same name from the same package",
+			parameter: "barrels=package",
+			files: []string{
+				barrelFile("a.proto", "acme", "gen/a", "ExampleClient"),
+				`name: "b.proto" package: "acme" syntax: "proto3"
+options { [tsjson.npm_package]: "acme" [tsjson.import_path]: "gen/b" }
+message_type { name: "Req" }
+service {
+	name: "Example"
+	method { name: "Do" input_type: ".acme.Req" output_type: ".acme.Req" }
+}`,
+			},
+			diagnostics: []string{"b.proto: barrel acme/index.ts would export ExampleClient from both a.proto and b.proto"},
+		},
+		{
+			name:      "barrel at a generated file",
+			parameter: "barrels=directory",
+			files: []string{
+				barrelFile("a.proto", "acme", "gen/index", "A"),
+				barrelFile("b.proto", "acme", "gen/b", "B"),
+			},
+			diagnostics: []string{"a.proto: barrel gen/index.ts collides with the output file generated from a.proto"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := generate(t, tt.parameter, tt.files...)
+			assertDiagnostics(t, err, tt.diagnostics...)
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Field numbers used in SourceCodeInfo location paths, see descriptor.proto for the full list
+const (
+	fileMessageTypePath   = 4
+	fileEnumTypePath      = 5
+	fileServicePath       = 6
+	messageFieldPath      = 2
+	messageNestedTypePath = 3
+	messageEnumTypePath   = 4
+	messageOneofDeclPath  = 8
+	enumValuePath         = 2
+	serviceMethodPath     = 2
+)
+
+// commentSet maps SourceCodeInfo location paths to their locations, so comments can be looked up for any descriptor element
+type commentSet map[string]*descriptorpb.SourceCodeInfo_Location
+
+// buildCommentSet indexes every location with comments attached in the source code info of a file
+func buildCommentSet(info *descriptorpb.SourceCodeInfo) commentSet {
+	comments := commentSet{}
+	for _, location := range info.GetLocation() {
+		if location.LeadingComments == nil && location.TrailingComments == nil && len(location.GetLeadingDetachedComments()) == 0 {
+			continue
+		}
+		comments[pathKey(location.GetPath())] = location
+	}
+	return comments
+}
+
+// pathKey turns a location path into a string usable as a map key
+func pathKey(path []int32) string {
+	parts := make([]string, len(path))
+	for i, part := range path {
+		parts[i] = fmt.Sprint(part)
+	}
+	return strings.Join(parts, ",")
+}
+
+// childPath creates a new path to a child element, without modifying the parent path's underlying array
+func childPath(path []int32, elements ...int32) []int32 {
+	out := make([]int32, 0, len(path)+len(elements))
+	out = append(out, path...)
+	return append(out, elements...)
+}
+
+// generate writes the comments for the element at path with the specified indentation.
+//
+// Detached comments are written first as plain line comments separated from the element by a blank line, so they can't be mistaken for its documentation.
+// Leading and trailing comments are then combined into the TSDoc block documenting the element itself.
+// Elements without any comments produce an empty string.
+func (c commentSet) generate(path []int32, indent string) string {
+	location, ok := c[pathKey(path)]
+	if !ok {
+		return ""
+	}
+	content := &strings.Builder{}
+	for _, detached := range location.GetLeadingDetachedComments() {
+		content.WriteString(formatLineComment(detached, indent))
+	}
+	var docParts []string
+	for _, part := range []string{location.GetLeadingComments(), location.GetTrailingComments()} {
+		if strings.TrimSpace(part) != "" {
+			docParts = append(docParts, strings.TrimRight(part, "\n"))
+		}
+	}
+	if len(docParts) > 0 {
+		content.WriteString(formatComment(strings.Join(docParts, "\n\n"), indent))
+	}
+	return content.String()
+}
+
+// formatLineComment converts raw proto comment text into // comments followed by a blank line
+func formatLineComment(text, indent string) string {
+	content := &strings.Builder{}
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		line = strings.TrimRight(strings.TrimPrefix(line, " "), " \t\r")
+		if line == "" {
+			content.WriteString(fmt.Sprintf("%s//\n", indent))
+			continue
+		}
+		content.WriteString(fmt.Sprintf("%s// %s\n", indent, line))
+	}
+	content.WriteString("\n")
+	return content.String()
+}
+
+// formatComment converts raw proto comment text into a TSDoc block, using the single line form where possible
+func formatComment(text, indent string) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	for i, line := range lines {
+		// protoc leaves the space following the comment marker in place, strip it along with trailing whitespace, then make sure nothing can close the block early
+		line = strings.TrimRight(strings.TrimPrefix(line, " "), " \t\r")
+		lines[i] = strings.ReplaceAll(line, "*/", "*\\/")
+	}
+	if len(lines) == 1 {
+		return fmt.Sprintf("%s/** %s */\n", indent, strings.TrimSpace(lines[0]))
+	}
+	content := &strings.Builder{}
+	content.WriteString(fmt.Sprintf("%s/**\n", indent))
+	for _, line := range lines {
+		if line == "" {
+			content.WriteString(fmt.Sprintf("%s *\n", indent))
+			continue
+		}
+		content.WriteString(fmt.Sprintf("%s * %s\n", indent, line))
+	}
+	content.WriteString(fmt.Sprintf("%s */\n", indent))
+	return content.String()
+}
@@ -0,0 +1,48 @@
+package codegen
+
+import "testing"
+
+func TestComments(t *testing.T) {
+	content := generateFile(t, "", "test.ts", proto3File(`
+message_type {
+	name: "Example"
+	field { name: "a" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING oneof_index: 0 }
+	field { name: "b" number: 2 label: LABEL_OPTIONAL type: TYPE_INT32 oneof_index: 0 }
+	field { name: "c" number: 3 label: LABEL_OPTIONAL type: TYPE_STRING }
+	field { name: "d" number: 4 label: LABEL_OPTIONAL type: TYPE_BOOL }
+	oneof_decl { name: "choice" }
+}
+enum_type {
+	name: "Kind"
+	value { name: "KIND_UNKNOWN" number: 0 }
+}
+source_code_info {
+	location { path: [4, 0] span: [8, 0, 16, 1] leading_detached_comments: " detached one\n" leading_detached_comments: " detached two\n second line\n" leading_comments: " The example\n" }
+	location { path: [4, 0, 8, 0] span: [9, 1, 12, 2] leading_comments: " the choice\n" }
+	location { path: [4, 0, 2, 0] span: [10, 2, 16] leading_comments: " member a\n" trailing_comments: " trailing a\n" }
+	location { path: [4, 0, 2, 2] span: [13, 1, 16] trailing_comments: " trailing c\n" }
+	location { path: [4, 0, 2, 3] span: [15, 1, 13] leading_detached_comments: " detached from d\n" }
+	location { path: [5, 0] span: [17, 0, 19, 1] leading_comments: " Multiple\n\n paragraphs with */ inside\n" }
+}`))
+	assertContains(t, content,
+		"// detached one\n\n// detached two\n// second line\n\n/** The example */\nexport class Example ",
+		"\t/** the choice */\n\tpublic choice?:\n\t\t/**\n\t\t * member a\n\t\t *\n\t\t * trailing a\n\t\t */\n\t\t| { case: \"a\", value: string }\n\t\t| { case: \"b\", value: number };\n",
+		"\t/** trailing c */\n\tpublic c?: string;\n",
+		"\t// detached from d\n\n\tpublic d?: boolean;\n",
+		"/**\n * Multiple\n *\n * paragraphs with *\\/ inside\n */\nexport enum Kind {",
+	)
+}
+
+func TestOneofWithoutMemberComments(t *testing.T) {
+	content := generateFile(t, "", "test.ts", proto3File(`
+message_type {
+	name: "Example"
+	field { name: "a" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING oneof_index: 0 }
+	field { name: "b" number: 2 label: LABEL_OPTIONAL type: TYPE_INT32 oneof_index: 0 }
+	oneof_decl { name: "choice" }
+}
+source_code_info {
+	location { path: [4, 0, 8, 0] span: [1, 1, 4, 2] leading_comments: " the choice\n" }
+}`))
+	assertContains(t, content, "\t/** the choice */\n\tpublic choice?: { case: \"a\", value: string } | { case: \"b\", value: number };\n")
+}
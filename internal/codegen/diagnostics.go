@@ -0,0 +1,173 @@
+package codegen
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Problems found while generating code are collected as diagnostics rather than stopping at the first one, so a single protoc run reports everything wrong with a schema.
+// Each diagnostic is located using the source code info of the file it was found in, and they are all reported together in the compiler style used by protoc itself, e.g.
+//
+// 	test/root.proto:12:3: test.RootMessage.api: type google.protobuf.Api is not supported, the runtime only provides the well-known types
+
+// diagnostic is a single problem found in a proto file
+type diagnostic struct {
+	file string
+	// line and column are 1-based, both are 0 when the source code info has no location for the element
+	line    int32
+	column  int32
+	element string
+	message string
+}
+
+func (d diagnostic) String() string {
+	position := d.file
+	if d.line > 0 {
+		position = fmt.Sprintf("%s:%d:%d", d.file, d.line, d.column)
+	}
+	if d.element == "" {
+		return fmt.Sprintf("%s: %s", position, d.message)
+	}
+	return fmt.Sprintf("%s: %s: %s", position, d.element, d.message)
+}
+
+// diagnostics collects every problem found while generating a request
+type diagnostics struct {
+	list []diagnostic
+}
+
+// forFile creates a collector for problems found in a single file, which all end up in this set
+func (d *diagnostics) forFile(f *descriptorpb.FileDescriptorProto) *fileDiagnostics {
+	spans := make(map[string][]int32, len(f.GetSourceCodeInfo().GetLocation()))
+	for _, location := range f.GetSourceCodeInfo().GetLocation() {
+		key := pathKey(location.GetPath())
+		// protoc can emit several locations for the same path, the first one spans the whole element
+		if _, ok := spans[key]; !ok {
+			spans[key] = location.GetSpan()
+		}
+	}
+	return &fileDiagnostics{all: d, file: f, spans: spans}
+}
+
+// err combines all collected problems into a single error, one per line ordered by position, or returns nil if there were none
+func (d *diagnostics) err() error {
+	if len(d.list) == 0 {
+		return nil
+	}
+	sorted := make([]diagnostic, len(d.list))
+	copy(sorted, d.list)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.file != b.file {
+			return a.file < b.file
+		}
+		if a.line != b.line {
+			return a.line < b.line
+		}
+		return a.column < b.column
+	})
+	lines := make([]string, 0, len(sorted))
+	for _, diag := range sorted {
+		line := diag.String()
+		// The same problem can be found from more than one place, e.g. while importing a type and again while using it
+		if len(lines) > 0 && lines[len(lines)-1] == line {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return errors.New(strings.Join(lines, "\n"))
+}
+
+// fileDiagnostics records problems against elements of a single file
+type fileDiagnostics struct {
+	all   *diagnostics
+	file  *descriptorpb.FileDescriptorProto
+	spans map[string][]int32
+}
+
+// add records a problem with the element at path, a nil path refers to the file as a whole
+func (d *fileDiagnostics) add(path []int32, format string, args ...interface{}) {
+	diag := diagnostic{
+		file:    d.file.GetName(),
+		element: getElementName(d.file, path),
+		message: fmt.Sprintf(format, args...),
+	}
+	if span, ok := d.spans[pathKey(path)]; ok && len(span) >= 2 {
+		diag.line = span[0] + 1
+		diag.column = span[1] + 1
+	}
+	d.all.list = append(d.all.list, diag)
+}
+
+// getElementName converts a location path to the fully qualified proto name of the element it refers to, e.g. [4, 0, 2, 1] to "test.RootMessage.second".
+// Paths into named elements resolve as far as they can, paths to anything else (e.g. file options) give an empty name.
+func getElementName(f *descriptorpb.FileDescriptorProto, path []int32) string {
+	name := f.GetPackage()
+	join := func(child string) {
+		if name == "" {
+			name = child
+			return
+		}
+		name = name + "." + child
+	}
+	if len(path) < 2 {
+		return ""
+	}
+	index := path[1]
+	switch path[0] {
+	case fileMessageTypePath:
+		if int(index) >= len(f.GetMessageType()) {
+			return name
+		}
+		msg := f.GetMessageType()[index]
+		join(msg.GetName())
+		path = path[2:]
+		for len(path) >= 2 {
+			index = path[1]
+			switch path[0] {
+			case messageNestedTypePath:
+				if int(index) >= len(msg.GetNestedType()) {
+					return name
+				}
+				msg = msg.GetNestedType()[index]
+				join(msg.GetName())
+				path = path[2:]
+				continue
+			case messageFieldPath:
+				if int(index) < len(msg.GetField()) {
+					join(msg.GetField()[index].GetName())
+				}
+			case messageOneofDeclPath:
+				if int(index) < len(msg.GetOneofDecl()) {
+					join(msg.GetOneofDecl()[index].GetName())
+				}
+			case messageEnumTypePath:
+				if int(index) < len(msg.GetEnumType()) {
+					join(msg.GetEnumType()[index].GetName())
+				}
+			}
+			return name
+		}
+	case fileEnumTypePath:
+		if int(index) < len(f.GetEnumType()) {
+			join(f.GetEnumType()[index].GetName())
+		}
+	case fileServicePath:
+		if int(index) >= len(f.GetService()) {
+			return name
+		}
+		service := f.GetService()[index]
+		join(service.GetName())
+		if len(path) >= 4 && path[2] == serviceMethodPath && int(path[3]) < len(service.GetMethod()) {
+			join(service.GetMethod()[path[3]].GetName())
+		}
+	default:
+		// Options and other locations which aren't named elements
+		return ""
+	}
+	return name
+}
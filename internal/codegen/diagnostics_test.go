@@ -0,0 +1,87 @@
+package codegen
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestDiagnosticsAreCollectedAndSorted(t *testing.T) {
+	_, err := generate(t, "", proto3File(`
+message_type {
+	name: "Example"
+	field { name: "nothing" number: 1 label: LABEL_OPTIONAL type: TYPE_ENUM type_name: ".google.protobuf.NullValue" }
+	field { name: "missing" number: 2 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".test.Missing" }
+	nested_type { name: "Inner" field { name: "gone" number: 1 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".test.Gone" } }
+}
+service { name: "Svc" method { name: "Do" input_type: ".test.Missing" output_type: ".test.Example" } }
+source_code_info {
+	location { path: [4, 0, 2, 0] span: [9, 2, 40] }
+	location { path: [4, 0, 2, 1] span: [5, 2, 20] }
+	location { path: [4, 0, 2, 1] span: [5, 11, 18] }
+	location { path: [6, 0, 2, 0] span: [12, 2, 40] }
+}`))
+	// Elements without a location come first, the rest are ordered by position, and the unknown type of "missing" is reported once even though both its import and its property find it
+	assertDiagnostics(t, err,
+		"test.proto: test.Example.Inner.gone: unknown type .test.Gone",
+		"test.proto:6:3: test.Example.missing: unknown type .test.Missing",
+		"test.proto:10:3: test.Example.nothing: google.protobuf.NullValue is only supported as a oneof member",
+		"test.proto:13:3: test.Svc.Do: unknown type .test.Missing",
+	)
+}
+
+func TestDiagnosticsAcrossFiles(t *testing.T) {
+	_, err := generate(t, "",
+		`name: "b.proto" package: "b" syntax: "proto3"
+options { [tsjson.npm_package]: "@acme/test" [tsjson.import_path]: "b" }
+message_type { name: "B" field { name: "missing" number: 1 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".b.Missing" } }`,
+		`name: "a.proto" package: "a" syntax: "proto3"
+options { [tsjson.npm_package]: "@acme/test" [tsjson.import_path]: "a" }
+message_type { name: "A" field { name: "missing" number: 1 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".a.Missing" } }`,
+	)
+	assertDiagnostics(t, err,
+		"a.proto: a.A.missing: unknown type .a.Missing",
+		"b.proto: b.B.missing: unknown type .b.Missing",
+	)
+}
+
+func TestGetElementName(t *testing.T) {
+	file := &descriptorpb.FileDescriptorProto{}
+	if err := prototext.Unmarshal([]byte(`name: "test.proto" package: "test"
+message_type {
+	name: "Outer"
+	field { name: "value" }
+	oneof_decl { name: "choice" }
+	enum_type { name: "Kind" }
+	nested_type { name: "Inner" field { name: "deep" } }
+}
+enum_type { name: "Colour" value { name: "RED" } }
+service { name: "Svc" method { name: "Do" } }`), file); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path []int32
+		want string
+	}{
+		{path: nil, want: ""},
+		{path: []int32{4, 0}, want: "test.Outer"},
+		{path: []int32{4, 0, 2, 0}, want: "test.Outer.value"},
+		{path: []int32{4, 0, 8, 0}, want: "test.Outer.choice"},
+		{path: []int32{4, 0, 4, 0}, want: "test.Outer.Kind"},
+		{path: []int32{4, 0, 3, 0}, want: "test.Outer.Inner"},
+		{path: []int32{4, 0, 3, 0, 2, 0}, want: "test.Outer.Inner.deep"},
+		{path: []int32{4, 0, 7}, want: "test.Outer"},
+		{path: []int32{4, 5}, want: "test"},
+		{path: []int32{5, 0}, want: "test.Colour"},
+		{path: []int32{5, 0, 2, 0}, want: "test.Colour"},
+		{path: []int32{6, 0}, want: "test.Svc"},
+		{path: []int32{6, 0, 2, 0}, want: "test.Svc.Do"},
+		{path: []int32{8, 1}, want: ""},
+	}
+	for _, tt := range tests {
+		if got := getElementName(file, tt.path); got != tt.want {
+			t.Errorf("getElementName(%v) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package codegen
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Editions supported by this plugin, proto2 and proto3 files are treated as the equivalent legacy editions
+const (
+	minimumEdition = descriptorpb.Edition_EDITION_PROTO2
+	maximumEdition = descriptorpb.Edition_EDITION_2023
+)
+
+const syntaxEditions = "editions"
+
+// resolvedFeatures holds the values of the edition features relevant to protojson for a single element, after inheritance from its parents.
+//
+// Field presence and enum type change the generated code. Repeated field encoding only affects the binary wire format and json format only
+// controls whether protoc enforces JSON name conflicts, so neither changes generated code, but both are resolved so the feature set is complete.
+type resolvedFeatures struct {
+	fieldPresence         descriptorpb.FeatureSet_FieldPresence
+	enumType              descriptorpb.FeatureSet_EnumType
+	repeatedFieldEncoding descriptorpb.FeatureSet_RepeatedFieldEncoding
+	jsonFormat            descriptorpb.FeatureSet_JsonFormat
+}
+
+// getEdition determines the edition of a file, mapping the proto2 and proto3 syntaxes to their legacy editions
+func getEdition(f *descriptorpb.FileDescriptorProto) (descriptorpb.Edition, error) {
+	switch f.GetSyntax() {
+	case "", "proto2":
+		return descriptorpb.Edition_EDITION_PROTO2, nil
+	case "proto3":
+		return descriptorpb.Edition_EDITION_PROTO3, nil
+	case syntaxEditions:
+		edition := f.GetEdition()
+		if edition < descriptorpb.Edition_EDITION_2023 || edition > maximumEdition {
+			return edition, fmt.Errorf("edition %s in %s is not supported by protoc-gen-tsjson, the latest supported edition is %s", edition, f.GetName(), maximumEdition)
+		}
+		return edition, nil
+	default:
+		return descriptorpb.Edition_EDITION_UNKNOWN, fmt.Errorf("syntax %s in %s is not supported by protoc-gen-tsjson", f.GetSyntax(), f.GetName())
+	}
+}
+
+// getEditionDefaults returns the default features for an edition
+func getEditionDefaults(edition descriptorpb.Edition) resolvedFeatures {
+	switch edition {
+	case descriptorpb.Edition_EDITION_PROTO2:
+		return resolvedFeatures{
+			fieldPresence:         descriptorpb.FeatureSet_EXPLICIT,
+			enumType:              descriptorpb.FeatureSet_CLOSED,
+			repeatedFieldEncoding: descriptorpb.FeatureSet_EXPANDED,
+			jsonFormat:            descriptorpb.FeatureSet_LEGACY_BEST_EFFORT,
+		}
+	case descriptorpb.Edition_EDITION_PROTO3:
+		return resolvedFeatures{
+			fieldPresence:         descriptorpb.FeatureSet_IMPLICIT,
+			enumType:              descriptorpb.FeatureSet_OPEN,
+			repeatedFieldEncoding: descriptorpb.FeatureSet_PACKED,
+			jsonFormat:            descriptorpb.FeatureSet_ALLOW,
+		}
+	default:
+		// Edition 2023
+		return resolvedFeatures{
+			fieldPresence:         descriptorpb.FeatureSet_EXPLICIT,
+			enumType:              descriptorpb.FeatureSet_OPEN,
+			repeatedFieldEncoding: descriptorpb.FeatureSet_PACKED,
+			jsonFormat:            descriptorpb.FeatureSet_ALLOW,
+		}
+	}
+}
+
+// merge overrides the inherited features with any set explicitly on a child element
+func (r resolvedFeatures) merge(set *descriptorpb.FeatureSet) resolvedFeatures {
+	if set == nil {
+		return r
+	}
+	if set.FieldPresence != nil {
+		r.fieldPresence = set.GetFieldPresence()
+	}
+	if set.EnumType != nil {
+		r.enumType = set.GetEnumType()
+	}
+	if set.RepeatedFieldEncoding != nil {
+		r.repeatedFieldEncoding = set.GetRepeatedFieldEncoding()
+	}
+	if set.JsonFormat != nil {
+		r.jsonFormat = set.GetJsonFormat()
+	}
+	return r
+}
+
+// getFileFeatures resolves the features of a file, which are inherited by everything declared in it
+func getFileFeatures(f *descriptorpb.FileDescriptorProto) (resolvedFeatures, error) {
+	edition, err := getEdition(f)
+	if err != nil {
+		return resolvedFeatures{}, err
+	}
+	return getEditionDefaults(edition).merge(f.GetOptions().GetFeatures()), nil
+}
+
+// getFieldFeatures resolves the features of a field, which inherits from its oneof (if any) and then its message
+func getFieldFeatures(msg *descriptorpb.DescriptorProto, field *descriptorpb.FieldDescriptorProto, msgFeatures resolvedFeatures) resolvedFeatures {
+	features := msgFeatures
+	if field.OneofIndex != nil && int(field.GetOneofIndex()) < len(msg.GetOneofDecl()) {
+		features = features.merge(msg.GetOneofDecl()[field.GetOneofIndex()].GetOptions().GetFeatures())
+	}
+	return features.merge(field.GetOptions().GetFeatures())
+}
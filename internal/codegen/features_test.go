@@ -0,0 +1,73 @@
+package codegen
+
+import "testing"
+
+// editionsFile is a text format edition 2023 file named test.proto in package test, with the tsjson options and any file features set, body holds its messages and enums
+func editionsFile(features, body string) string {
+	return `name: "test.proto" package: "test" syntax: "editions" edition: EDITION_2023
+options { [tsjson.npm_package]: "@acme/test" [tsjson.import_path]: "test" features { ` + features + ` } }
+` + body
+}
+
+func TestEditionsEnumType(t *testing.T) {
+	tests := []struct {
+		name         string
+		fileFeatures string
+		enumOptions  string
+		allowUnknown string
+	}{
+		{name: "default open", allowUnknown: "true"},
+		{name: "file closed", fileFeatures: "enum_type: CLOSED", allowUnknown: "false"},
+		{name: "enum closed", enumOptions: "options { features { enum_type: CLOSED } }", allowUnknown: "false"},
+		{name: "enum open in closed file", fileFeatures: "enum_type: CLOSED", enumOptions: "options { features { enum_type: OPEN } }", allowUnknown: "true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := generateFile(t, "", "test.ts", editionsFile(tt.fileFeatures, `
+message_type {
+	name: "Example"
+	field { name: "kind" number: 1 label: LABEL_OPTIONAL type: TYPE_ENUM type_name: ".test.Kind" }
+	field { name: "kinds" number: 2 label: LABEL_REPEATED type: TYPE_ENUM type_name: ".test.Kind" }
+}
+enum_type {
+	name: "Kind"
+	value { name: "KIND_UNKNOWN" number: 0 }
+	`+tt.enumOptions+`
+}`))
+			assertContains(t, content,
+				`res.kind = await tsjson.Parse.Enum(objData, "kind", "kind", Kind, `+tt.allowUnknown+`);`,
+				`tsjson.PrimitiveParse.Enum(Kind, `+tt.allowUnknown+`)`,
+			)
+		})
+	}
+}
+
+func TestEditionsFieldPresence(t *testing.T) {
+	tests := []struct {
+		name         string
+		fileFeatures string
+		fieldOptions string
+		want         string
+	}{
+		{name: "default explicit", want: "count: tsjson.ToProtoJSON.Number(this.count),"},
+		{name: "file implicit", fileFeatures: "field_presence: IMPLICIT", want: "count: tsjson.ToProtoJSON.Number(tsjson.ToProtoJSON.NonZero(this.count)),"},
+		{name: "field implicit", fieldOptions: "options { features { field_presence: IMPLICIT } }", want: "count: tsjson.ToProtoJSON.Number(tsjson.ToProtoJSON.NonZero(this.count)),"},
+		{name: "field explicit in implicit file", fileFeatures: "field_presence: IMPLICIT", fieldOptions: "options { features { field_presence: EXPLICIT } }", want: "count: tsjson.ToProtoJSON.Number(this.count),"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := generateFile(t, "", "test.ts", editionsFile(tt.fileFeatures, `
+message_type {
+	name: "Example"
+	field { name: "count" number: 1 label: LABEL_OPTIONAL type: TYPE_INT32 `+tt.fieldOptions+` }
+}`))
+			assertContains(t, content, tt.want)
+		})
+	}
+}
+
+func TestUnsupportedEdition(t *testing.T) {
+	_, err := generate(t, "", `name: "test.proto" package: "test" syntax: "editions" edition: EDITION_2024
+options { [tsjson.npm_package]: "@acme/test" [tsjson.import_path]: "test" }`)
+	assertDiagnostics(t, err, "test.proto: edition EDITION_2024 in test.proto is not supported by protoc-gen-tsjson, the latest supported edition is EDITION_2023")
+}
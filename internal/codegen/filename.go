@@ -1,6 +1,9 @@
 package codegen
 
-import "strings"
+import (
+	"path"
+	"strings"
+)
 
 type filename struct {
 	pathParts            []string
@@ -11,10 +14,9 @@ type filename struct {
 // Takes input like "sampleproto/test.proto" and splits it into path components and the final name stripped of the .proto extension
 // This works even on windows systems where the path may be passed with a backslash, since protoc fixes this for us
 //
-// It will break if the file name includes ".proto" as part of the actual name, e.g. "test.proto.stuff.proto" will become "test" and discard the rest
-// That's a pretty strange naming pattern though, and for now I'm OK with not supporting it.
+// Only a trailing .proto is stripped, so names like "my.protocol.proto" keep everything else
 func filenameFromProto(in string) (out filename) {
-	out.fullWithoutExtension = strings.Split(in, ".proto")[0]
+	out.fullWithoutExtension = strings.TrimSuffix(in, ".proto")
 	// Split on all slashes first
 	parts := strings.Split(in, "/")
 	// Name will always be the last component, whether that's the 0th or 500th, and strings.Split always returns at least 1 element
@@ -24,6 +26,16 @@ func filenameFromProto(in string) (out filename) {
 		out.pathParts = parts[:len(parts)-1]
 	}
 	// Strip the extension from the filename
-	out.name = strings.Split(lastPart, ".proto")[0]
+	out.name = strings.TrimSuffix(lastPart, ".proto")
 	return
 }
+
+// defaultImportPath is the path of a file's generated code within its npm package when it isn't set explicitly, which depends on the paths parameter.
+// In package mode files are grouped into one directory per proto package, e.g. a file b.proto in package acme.billing is at acme/billing/b, and otherwise the path is the proto file's path.
+func defaultImportPath(protoFile, protoPackage string, mode pathsMode) string {
+	parsed := filenameFromProto(protoFile)
+	if mode == pathsPackage {
+		return path.Join(strings.ReplaceAll(protoPackage, ".", "/"), parsed.name)
+	}
+	return parsed.fullWithoutExtension
+}
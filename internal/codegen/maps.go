@@ -0,0 +1,44 @@
+package codegen
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Maps are generated as a ReadonlyMap of the key type to the value type, or null for values which were null in the JSON.
+// Protojson writes maps as objects, so keys are always strings on the wire: integers are written in decimal and bools as "true" or "false",
+// and each key type is parsed back by its own tsjson.MapKeys function which rejects anything else.
+// Values use the same marshalling as a single element of a repeated field.
+
+// mapKeyParsers maps every legal key type to the name of the tsjson.MapKeys function parsing it
+var mapKeyParsers = map[descriptorpb.FieldDescriptorProto_Type]string{
+	descriptorpb.FieldDescriptorProto_TYPE_STRING:   "ParseString",
+	descriptorpb.FieldDescriptorProto_TYPE_BOOL:     "ParseBool",
+	descriptorpb.FieldDescriptorProto_TYPE_INT32:    "ParseInt32",
+	descriptorpb.FieldDescriptorProto_TYPE_SINT32:   "ParseInt32",
+	descriptorpb.FieldDescriptorProto_TYPE_SFIXED32: "ParseInt32",
+	descriptorpb.FieldDescriptorProto_TYPE_UINT32:   "ParseUint32",
+	descriptorpb.FieldDescriptorProto_TYPE_FIXED32:  "ParseUint32",
+	descriptorpb.FieldDescriptorProto_TYPE_INT64:    "ParseInt64",
+	descriptorpb.FieldDescriptorProto_TYPE_SINT64:   "ParseInt64",
+	descriptorpb.FieldDescriptorProto_TYPE_SFIXED64: "ParseInt64",
+	descriptorpb.FieldDescriptorProto_TYPE_UINT64:   "ParseUint64",
+	descriptorpb.FieldDescriptorProto_TYPE_FIXED64:  "ParseUint64",
+}
+
+// generateMapMarshalling creates the ToProtoJSON expression and Parse expression for a map field, entry is the map entry message protoc created for it
+func generateMapMarshalling(field *descriptorpb.FieldDescriptorProto, entry *descriptorpb.DescriptorProto, types typeResolver, inputName, obj string) (toProtoJSON, parse string, err error) {
+	key, value := entry.GetField()[0], entry.GetField()[1]
+	keyParser, ok := mapKeyParsers[key.GetType()]
+	if !ok {
+		return "", "", fmt.Errorf("invalid map key type %s", key.GetType())
+	}
+	codec, err := getValueCodec(value, types)
+	if err != nil {
+		return "", "", fmt.Errorf("map value: %v", err)
+	}
+	toProtoJSON = fmt.Sprintf(`tsjson.ToProtoJSON.Map(%s, %s)`, codec.elementToProtoJSON(), inputName)
+	parse = fmt.Sprintf(`tsjson.Parse.Map(%s, "%s", "%s", tsjson.MapKeys.%s, %s)`, obj, field.GetJsonName(), field.GetName(), keyParser, codec.elementParser())
+	return
+}
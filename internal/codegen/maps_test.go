@@ -0,0 +1,83 @@
+package codegen
+
+import "testing"
+
+// mapFile is a proto3 file with a single map field, with the key and value fields of its entry given in text format
+func mapFile(key, value string) string {
+	return proto3File(`
+message_type {
+	name: "Example"
+	field { name: "values" number: 1 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".test.Example.ValuesEntry" }
+	nested_type {
+		name: "ValuesEntry"
+		field { name: "key" number: 1 label: LABEL_OPTIONAL ` + key + ` }
+		field { name: "value" number: 2 label: LABEL_OPTIONAL ` + value + ` }
+		options { map_entry: true }
+	}
+}`)
+}
+
+func TestMapKeys(t *testing.T) {
+	tests := []struct {
+		keyType string
+		tsType  string
+		parser  string
+	}{
+		{keyType: "TYPE_STRING", tsType: "string", parser: "ParseString"},
+		{keyType: "TYPE_BOOL", tsType: "boolean", parser: "ParseBool"},
+		{keyType: "TYPE_INT32", tsType: "number", parser: "ParseInt32"},
+		{keyType: "TYPE_SINT32", tsType: "number", parser: "ParseInt32"},
+		{keyType: "TYPE_SFIXED32", tsType: "number", parser: "ParseInt32"},
+		{keyType: "TYPE_UINT32", tsType: "number", parser: "ParseUint32"},
+		{keyType: "TYPE_FIXED32", tsType: "number", parser: "ParseUint32"},
+		{keyType: "TYPE_INT64", tsType: "number", parser: "ParseInt64"},
+		{keyType: "TYPE_SINT64", tsType: "number", parser: "ParseInt64"},
+		{keyType: "TYPE_SFIXED64", tsType: "number", parser: "ParseInt64"},
+		{keyType: "TYPE_UINT64", tsType: "number", parser: "ParseUint64"},
+		{keyType: "TYPE_FIXED64", tsType: "number", parser: "ParseUint64"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.keyType, func(t *testing.T) {
+			content := generateFile(t, "", "test.ts", mapFile("type: "+tt.keyType, "type: TYPE_STRING"))
+			assertContains(t, content,
+				"public values?: ReadonlyMap<"+tt.tsType+", string | null>;",
+				"values: tsjson.ToProtoJSON.Map(tsjson.ToProtoJSON.String, this.values),",
+				`res.values = await tsjson.Parse.Map(objData, "values", "values", tsjson.MapKeys.`+tt.parser+`, tsjson.PrimitiveParse.String());`,
+			)
+			// Map entries are never generated as classes of their own
+			assertNotContains(t, content, "ValuesEntry")
+		})
+	}
+}
+
+func TestMapValues(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		tsType      string
+		toProtoJSON string
+		parser      string
+	}{
+		{name: "int64", value: "type: TYPE_INT64", tsType: "number", toProtoJSON: "tsjson.ToProtoJSON.StringNumber", parser: "tsjson.PrimitiveParse.Number()"},
+		{name: "bytes", value: "type: TYPE_BYTES", tsType: "Uint8Array", toProtoJSON: "tsjson.ToProtoJSON.Bytes", parser: "tsjson.PrimitiveParse.Bytes()"},
+		{name: "enum", value: `type: TYPE_ENUM type_name: ".test.Kind"`, tsType: "Kind", toProtoJSON: "val => tsjson.ToProtoJSON.Enum(Kind, val)", parser: "tsjson.PrimitiveParse.Enum(Kind, true)"},
+		{name: "message", value: `type: TYPE_MESSAGE type_name: ".test.Other"`, tsType: "Other", toProtoJSON: "val => val.ToProtoJSON()", parser: "tsjson.PrimitiveParse.Message(Other.Parse)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := generateFile(t, "", "test.ts", mapFile("type: TYPE_STRING", tt.value)+`
+message_type { name: "Other" }
+enum_type { name: "Kind" value { name: "KIND_UNKNOWN" number: 0 } }`)
+			assertContains(t, content,
+				"public values?: ReadonlyMap<string, "+tt.tsType+" | null>;",
+				"values: tsjson.ToProtoJSON.Map("+tt.toProtoJSON+", this.values),",
+				`res.values = await tsjson.Parse.Map(objData, "values", "values", tsjson.MapKeys.ParseString, `+tt.parser+`);`,
+			)
+		})
+	}
+}
+
+func TestInvalidMapKey(t *testing.T) {
+	_, err := generate(t, "", mapFile("type: TYPE_DOUBLE", "type: TYPE_STRING"))
+	assertDiagnostics(t, err, "test.proto: test.Example.values: invalid map key type TYPE_DOUBLE")
+}
@@ -0,0 +1,130 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Every field is marshalled by the runtime helpers for its type, the same helpers are used whether the field is singular, repeated or a map value:
+//   - singular fields call them directly, e.g. tsjson.ToProtoJSON.Enum(Colour, this.colour) and tsjson.Parse.Enum(objData, "colour", "colour", Colour, true)
+//   - repeated fields and map values pass them per element to tsjson.ToProtoJSON.Repeated/Map, e.g. val => tsjson.ToProtoJSON.Enum(Colour, val) and tsjson.PrimitiveParse.Enum(Colour, true)
+//
+// Wrapper types are unwrapped to their values first, see wellknown.go, and maps are built from the key and value fields of their entry, see maps.go.
+
+// valueCodec describes the runtime helpers which write and read a single value of a proto type
+type valueCodec struct {
+	// helper is the name of the type's tsjson.Parse and tsjson.PrimitiveParse functions, and of its tsjson.ToProtoJSON function unless writeHelper is set
+	helper string
+	// writeHelper is set when values are written by a differently named function, e.g. 64-bit integers are read as numbers but written as strings
+	writeHelper string
+	// writeArgs and readArgs are passed to the helpers before the value, e.g. the enum object for enums
+	writeArgs []string
+	readArgs  []string
+	// writeMethod is set for messages, which are written by their own ToProtoJSON method rather than a helper
+	writeMethod bool
+}
+
+func (c valueCodec) write() string {
+	if c.writeHelper != "" {
+		return "tsjson.ToProtoJSON." + c.writeHelper
+	}
+	return "tsjson.ToProtoJSON." + c.helper
+}
+
+// singularToProtoJSON writes the value of a singular field
+func (c valueCodec) singularToProtoJSON(inputName string) string {
+	if c.writeMethod {
+		return inputName + "?.ToProtoJSON()"
+	}
+	return fmt.Sprintf("%s(%s)", c.write(), strings.Join(append(append([]string{}, c.writeArgs...), inputName), ", "))
+}
+
+// singularParse reads a singular field from obj
+func (c valueCodec) singularParse(obj string, field *descriptorpb.FieldDescriptorProto) string {
+	args := append([]string{obj, fmt.Sprintf(`"%s"`, field.GetJsonName()), fmt.Sprintf(`"%s"`, field.GetName())}, c.readArgs...)
+	return fmt.Sprintf("tsjson.Parse.%s(%s)", c.helper, strings.Join(args, ", "))
+}
+
+// elementToProtoJSON is a function writing a single value, for repeated fields and map values
+func (c valueCodec) elementToProtoJSON() string {
+	if c.writeMethod {
+		return "val => val.ToProtoJSON()"
+	}
+	if len(c.writeArgs) == 0 {
+		return c.write()
+	}
+	return fmt.Sprintf("val => %s", c.singularToProtoJSON("val"))
+}
+
+// elementParser is a tsjson.Parser reading a single value, for repeated fields and map values
+func (c valueCodec) elementParser() string {
+	return fmt.Sprintf("tsjson.PrimitiveParse.%s(%s)", c.helper, strings.Join(c.readArgs, ", "))
+}
+
+// getValueCodec finds the runtime helpers for the field's type, regardless of its label
+func getValueCodec(field *descriptorpb.FieldDescriptorProto, types typeResolver) (valueCodec, error) {
+	field = unwrapField(field)
+	switch field.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		return valueCodec{helper: "Bool"}, nil
+	case descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		return valueCodec{helper: "Bytes"}, nil
+	case descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, descriptorpb.FieldDescriptorProto_TYPE_FLOAT, descriptorpb.FieldDescriptorProto_TYPE_FIXED32, descriptorpb.FieldDescriptorProto_TYPE_INT32, descriptorpb.FieldDescriptorProto_TYPE_SFIXED32, descriptorpb.FieldDescriptorProto_TYPE_SINT32, descriptorpb.FieldDescriptorProto_TYPE_UINT32:
+		return valueCodec{helper: "Number"}, nil
+	case descriptorpb.FieldDescriptorProto_TYPE_FIXED64, descriptorpb.FieldDescriptorProto_TYPE_SFIXED64, descriptorpb.FieldDescriptorProto_TYPE_UINT64, descriptorpb.FieldDescriptorProto_TYPE_SINT64, descriptorpb.FieldDescriptorProto_TYPE_INT64:
+		return valueCodec{helper: "Number", writeHelper: "StringNumber"}, nil
+	case descriptorpb.FieldDescriptorProto_TYPE_STRING:
+		return valueCodec{helper: "String"}, nil
+	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_TYPE_GROUP:
+		if helper, ok := wellKnownHelpers[field.GetTypeName()]; ok {
+			return valueCodec{helper: helper}, nil
+		}
+		tsType, err := types.typeName(field.GetTypeName())
+		if err != nil {
+			return valueCodec{}, err
+		}
+		return valueCodec{helper: "Message", readArgs: []string{tsType + ".Parse"}, writeMethod: true}, nil
+	case descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		if isNullValue(field) {
+			return valueCodec{}, errNullValue
+		}
+		enum, err := types.lookup(field.GetTypeName())
+		if err != nil {
+			return valueCodec{}, err
+		}
+		tsType, err := types.typeName(field.GetTypeName())
+		if err != nil {
+			return valueCodec{}, err
+		}
+		// Open enums accept unknown numeric values, closed enums reject them
+		return valueCodec{helper: "Enum", writeArgs: []string{tsType}, readArgs: []string{tsType, fmt.Sprint(!enum.closed)}}, nil
+	default:
+		return valueCodec{}, fmt.Errorf("unknown field type %s", field.GetType())
+	}
+}
+
+// generateMarshallingStrings creates the ToProtoJSON expression and Parse expression for a field
+func generateMarshallingStrings(field *descriptorpb.FieldDescriptorProto, types typeResolver, inputName string, obj string) (toProtoJSON, parse string, err error) {
+	if field.GetType() == descriptorpb.FieldDescriptorProto_TYPE_MESSAGE {
+		s, err := types.lookup(field.GetTypeName())
+		if err != nil {
+			return "", "", err
+		}
+		if s.kind == symbolMapEntry {
+			return generateMapMarshalling(field, s.mapEntry, types, inputName, obj)
+		}
+	}
+	codec, err := getValueCodec(field, types)
+	if err != nil {
+		return "", "", err
+	}
+	// Required fields are marshalled like any other singular field, their presence is checked separately in Parse
+	if field.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED {
+		toProtoJSON = fmt.Sprintf("tsjson.ToProtoJSON.Repeated(%s, %s)", codec.elementToProtoJSON(), inputName)
+		parse = fmt.Sprintf(`tsjson.Parse.Repeated(%s, "%s", "%s", %s)`, obj, field.GetJsonName(), field.GetName(), codec.elementParser())
+		return
+	}
+	return codec.singularToProtoJSON(inputName), codec.singularParse(obj, field), nil
+}
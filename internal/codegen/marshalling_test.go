@@ -0,0 +1,90 @@
+package codegen
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestScalarMarshalling(t *testing.T) {
+	tests := []struct {
+		protoType   string
+		tsType      string
+		toProtoJSON string
+		parser      string
+	}{
+		{protoType: "TYPE_DOUBLE", tsType: "number", toProtoJSON: "Number", parser: "Number"},
+		{protoType: "TYPE_FLOAT", tsType: "number", toProtoJSON: "Number", parser: "Number"},
+		{protoType: "TYPE_INT32", tsType: "number", toProtoJSON: "Number", parser: "Number"},
+		{protoType: "TYPE_UINT32", tsType: "number", toProtoJSON: "Number", parser: "Number"},
+		{protoType: "TYPE_SINT32", tsType: "number", toProtoJSON: "Number", parser: "Number"},
+		{protoType: "TYPE_FIXED32", tsType: "number", toProtoJSON: "Number", parser: "Number"},
+		{protoType: "TYPE_SFIXED32", tsType: "number", toProtoJSON: "Number", parser: "Number"},
+		// 64-bit integers are strings in protojson
+		{protoType: "TYPE_INT64", tsType: "number", toProtoJSON: "StringNumber", parser: "Number"},
+		{protoType: "TYPE_UINT64", tsType: "number", toProtoJSON: "StringNumber", parser: "Number"},
+		{protoType: "TYPE_SINT64", tsType: "number", toProtoJSON: "StringNumber", parser: "Number"},
+		{protoType: "TYPE_FIXED64", tsType: "number", toProtoJSON: "StringNumber", parser: "Number"},
+		{protoType: "TYPE_SFIXED64", tsType: "number", toProtoJSON: "StringNumber", parser: "Number"},
+		{protoType: "TYPE_BOOL", tsType: "boolean", toProtoJSON: "Bool", parser: "Bool"},
+		{protoType: "TYPE_STRING", tsType: "string", toProtoJSON: "String", parser: "String"},
+		{protoType: "TYPE_BYTES", tsType: "Uint8Array", toProtoJSON: "Bytes", parser: "Bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.protoType, func(t *testing.T) {
+			content := generateFile(t, "", "test.ts", proto3File(fmt.Sprintf(`
+message_type {
+	name: "Example"
+	field { name: "one" number: 1 label: LABEL_OPTIONAL type: %[1]s }
+	field { name: "many" number: 2 label: LABEL_REPEATED type: %[1]s }
+	field { name: "either" number: 3 label: LABEL_OPTIONAL type: %[1]s oneof_index: 0 }
+	oneof_decl { name: "choice" }
+}`, tt.protoType)))
+			assertContains(t, content,
+				"public one?: "+tt.tsType+";",
+				"public many?: "+tt.tsType+"[];",
+				`public choice?: { case: "either", value: `+tt.tsType+` };`,
+				"one: tsjson.ToProtoJSON."+tt.toProtoJSON+"(tsjson.ToProtoJSON.NonZero(this.one)),",
+				"many: tsjson.ToProtoJSON.Repeated(tsjson.ToProtoJSON."+tt.toProtoJSON+", this.many),",
+				`either: this.choice?.case === "either" ? tsjson.ToProtoJSON.`+tt.toProtoJSON+`(this.choice.value) : undefined,`,
+				`res.one = await tsjson.Parse.`+tt.parser+`(objData, "one", "one");`,
+				`res.many = await tsjson.Parse.Repeated(objData, "many", "many", tsjson.PrimitiveParse.`+tt.parser+`());`,
+				`{ case: "either", value: await tsjson.Parse.`+tt.parser+`(objData, "either", "either") },`,
+			)
+		})
+	}
+}
+
+func TestRepeatedMessagesAndEnums(t *testing.T) {
+	content := generateFile(t, "", "test.ts", proto3File(`
+message_type {
+	name: "Example"
+	field { name: "inners" number: 1 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".test.Example.Inner" }
+	field { name: "kinds" number: 2 label: LABEL_REPEATED type: TYPE_ENUM type_name: ".test.Example.Kind" }
+	nested_type { name: "Inner" }
+	enum_type { name: "Kind" value { name: "KIND_UNKNOWN" number: 0 } }
+}`))
+	assertContains(t, content,
+		"public inners?: Example__Inner[];",
+		"public kinds?: Example__Kind[];",
+		"inners: tsjson.ToProtoJSON.Repeated(val => val.ToProtoJSON(), this.inners),",
+		"kinds: tsjson.ToProtoJSON.Repeated(val => tsjson.ToProtoJSON.Enum(Example__Kind, val), this.kinds),",
+		`res.inners = await tsjson.Parse.Repeated(objData, "inners", "inners", tsjson.PrimitiveParse.Message(Example__Inner.Parse));`,
+		`res.kinds = await tsjson.Parse.Repeated(objData, "kinds", "kinds", tsjson.PrimitiveParse.Enum(Example__Kind, true));`,
+	)
+}
+
+// Parse accepts both the JSON name and the proto name of every field
+func TestParseAcceptsBothNames(t *testing.T) {
+	content := generateFile(t, "", "test.ts", proto3File(`
+message_type {
+	name: "Example"
+	field { name: "display_name" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING }
+	field { name: "all_tags" number: 2 label: LABEL_REPEATED type: TYPE_STRING }
+}`))
+	assertContains(t, content,
+		"displayName: tsjson.ToProtoJSON.String(tsjson.ToProtoJSON.NonZero(this.displayName)),",
+		`res.displayName = await tsjson.Parse.String(objData, "displayName", "display_name");`,
+		`res.allTags = await tsjson.Parse.Repeated(objData, "allTags", "all_tags", tsjson.PrimitiveParse.String());`,
+	)
+	assertNotContains(t, content, "this.display_name")
+}
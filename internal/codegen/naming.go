@@ -0,0 +1,101 @@
+package codegen
+
+import (
+	"strings"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Proto type names are mangled into typescript identifiers so that two different proto names can never produce the same identifier:
+//   - nested types are named after all their containing messages joined by "__", e.g. Outer.Inner becomes Outer__Inner
+//   - underscores which would make that ambiguous, i.e. any underscore at the start or end of a name or next to another underscore, are replaced by "$", which can't appear in proto names.
+//     A message named Foo__Bar becomes Foo$$Bar, so it can't collide with Bar nested in Foo
+//   - types imported from other files are aliased with their package, mangled the same way with each part joined by "__", then "___" and the type's own name, e.g. test.sub.Outer.Inner is imported as test__sub___Outer__Inner
+//
+// Service client names are mangled the same way before "Client" is appended, e.g. a service named a___b generates a$$$bClient.
+// Mangled names never contain "___", so import aliases can't collide with anything declared locally either.
+// Other identifiers can still collide with generated types, e.g. a message named ExampleClient and the client for service Example, see checkIdentifierCollisions.
+
+const (
+	nestedSeparator  = "__"
+	packageSeparator = "___"
+)
+
+// mangleName makes a single proto identifier safe to join with nestedSeparator
+func mangleName(name string) string {
+	if !strings.Contains(name, "_") {
+		return name
+	}
+	out := []byte(name)
+	for i := range out {
+		if out[i] != '_' {
+			continue
+		}
+		if i == 0 || i == len(name)-1 || name[i-1] == '_' || name[i+1] == '_' {
+			out[i] = '$'
+		}
+	}
+	return string(out)
+}
+
+// mangleAlias builds the identifier a type is imported as, from its package and its local name in the file defining it
+func mangleAlias(pkgName, localName string) string {
+	parts := strings.Split(pkgName, ".")
+	if pkgName == "" {
+		parts = nil
+	}
+	for i, part := range parts {
+		parts[i] = mangleName(part)
+	}
+	return strings.Join(parts, nestedSeparator) + packageSeparator + localName
+}
+
+// identifierSource is the proto element a top-level typescript identifier was generated for
+type identifierSource struct {
+	path []int32
+	// description names the element for other diagnostics, e.g. "message test.Example"
+	description string
+}
+
+// checkIdentifierCollisions reports any two elements of the file which would be declared with the same identifier in the generated code.
+// Types can't take the names of the runtime imports, those are escaped like reserved words (see reserved.go).
+func checkIdentifierCollisions(f *descriptorpb.FileDescriptorProto, types typeResolver, opts options, diags *fileDiagnostics) {
+	declared := map[string]identifierSource{}
+	declare := func(identifier string, path []int32, kind string) {
+		description := kind + " " + getElementName(f, path)
+		if other, ok := declared[identifier]; ok {
+			diags.add(path, "generated identifier %s for this %s collides with %s", identifier, kind, other.description)
+			return
+		}
+		declared[identifier] = identifierSource{path: path, description: description}
+	}
+	protoPrefix := ""
+	if f.GetPackage() != "" {
+		protoPrefix = "." + f.GetPackage()
+	}
+	var declareMessages func(messages []*descriptorpb.DescriptorProto, protoPrefix string, path []int32)
+	declareEnums := func(enums []*descriptorpb.EnumDescriptorProto, protoPrefix string, path []int32) {
+		for i, enum := range enums {
+			declare(types.symbols[protoPrefix+"."+enum.GetName()].localName, childPath(path, int32(i)), "enum")
+		}
+	}
+	declareMessages = func(messages []*descriptorpb.DescriptorProto, protoPrefix string, path []int32) {
+		for i, msg := range messages {
+			if msg.GetOptions().GetMapEntry() {
+				continue
+			}
+			msgPath := childPath(path, int32(i))
+			fullName := protoPrefix + "." + msg.GetName()
+			declare(types.symbols[fullName].localName, msgPath, "message")
+			declareEnums(msg.GetEnumType(), fullName, childPath(msgPath, messageEnumTypePath))
+			declareMessages(msg.GetNestedType(), fullName, childPath(msgPath, messageNestedTypePath))
+		}
+	}
+	declareEnums(f.GetEnumType(), protoPrefix, []int32{fileEnumTypePath})
+	declareMessages(f.GetMessageType(), protoPrefix, []int32{fileMessageTypePath})
+	if opts.services {
+		for i, service := range f.GetService() {
+			declare(getClientName(service), []int32{fileServicePath, int32(i)}, "service client")
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package codegen
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMangleName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "Foo", want: "Foo"},
+		{name: "Foo_Bar", want: "Foo_Bar"},
+		{name: "Foo__Bar", want: "Foo$$Bar"},
+		{name: "a___b", want: "a$$$b"},
+		{name: "_Foo", want: "$Foo"},
+		{name: "Foo_", want: "Foo$"},
+		{name: "_", want: "$"},
+		{name: "a_b_c", want: "a_b_c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mangleName(tt.name); got != tt.want {
+				t.Errorf("mangleName(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+// Nested names are built from the mangled name of each containing message, every distinct nesting must produce a distinct identifier
+func TestMangledNestedNamesAreInjective(t *testing.T) {
+	nestings := [][]string{
+		{"Foo", "Bar"},
+		{"Foo__Bar"},
+		{"Foo_Bar"},
+		{"Foo___Bar"},
+		{"Foo_", "Bar"},
+		{"Foo", "_Bar"},
+		{"Foo_", "_Bar"},
+		{"Foo", "Bar", "Baz"},
+		{"Foo", "Bar__Baz"},
+		{"Foo__Bar", "Baz"},
+		{"Foo__Bar__Baz"},
+	}
+	seen := map[string][]string{}
+	for _, nesting := range nestings {
+		parts := make([]string, len(nesting))
+		for i, name := range nesting {
+			parts[i] = mangleName(name)
+		}
+		identifier := strings.Join(parts, nestedSeparator)
+		if strings.Contains(identifier, packageSeparator) {
+			t.Errorf("%v is mangled to %s, which contains the package separator", nesting, identifier)
+		}
+		if other, ok := seen[identifier]; ok {
+			t.Errorf("%v and %v are both mangled to %s", other, nesting, identifier)
+		}
+		seen[identifier] = nesting
+	}
+}
+
+func TestMangleAlias(t *testing.T) {
+	tests := []struct {
+		pkgName   string
+		localName string
+		want      string
+	}{
+		{pkgName: "test", localName: "RootMessage", want: "test___RootMessage"},
+		{pkgName: "test.sub", localName: "Outer__Inner", want: "test__sub___Outer__Inner"},
+		{pkgName: "", localName: "Foo", want: "___Foo"},
+		{pkgName: "a_.b", localName: "Foo", want: "a$__b___Foo"},
+		{pkgName: "a__b", localName: "Foo", want: "a$$b___Foo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := mangleAlias(tt.pkgName, tt.localName); got != tt.want {
+				t.Errorf("mangleAlias(%q, %q) = %q, want %q", tt.pkgName, tt.localName, got, tt.want)
+			}
+		})
+	}
+}
+
+// Aliases for different packages and local names must never be the same identifier, nor collide with any local name
+func TestMangleAliasIsInjective(t *testing.T) {
+	types := []struct {
+		pkgName string
+		// nesting is the type's name and those of its containing messages
+		nesting []string
+	}{
+		{pkgName: "a.b", nesting: []string{"C"}},
+		{pkgName: "a", nesting: []string{"b", "C"}},
+		{pkgName: "a", nesting: []string{"b__C"}},
+		{pkgName: "a__b", nesting: []string{"C"}},
+		{pkgName: "a_", nesting: []string{"b", "C"}},
+		{pkgName: "a", nesting: []string{"_b", "C"}},
+		{pkgName: "", nesting: []string{"a", "b", "C"}},
+		{pkgName: "a.b.C", nesting: []string{"D"}},
+		{pkgName: "a.b", nesting: []string{"C", "D"}},
+	}
+	seen := map[string]string{}
+	for _, typ := range types {
+		parts := make([]string, len(typ.nesting))
+		for i, name := range typ.nesting {
+			parts[i] = mangleName(name)
+		}
+		localName := strings.Join(parts, nestedSeparator)
+		alias := mangleAlias(typ.pkgName, localName)
+		description := typ.pkgName + "." + strings.Join(typ.nesting, ".")
+		if other, ok := seen[alias]; ok {
+			t.Errorf("%s and %s are both imported as %s", other, description, alias)
+		}
+		seen[alias] = description
+		if strings.Contains(localName, packageSeparator) {
+			t.Errorf("local name %s of %s contains the package separator", localName, description)
+		}
+	}
+}
+
+func TestIdentifierCollisions(t *testing.T) {
+	file := proto3File(`
+message_type { name: "Req" }
+message_type { name: "ExampleClient" }
+service {
+	name: "Example"
+	method { name: "Do" input_type: ".test.Req" output_type: ".test.Req" }
+}`)
+	_, err := generate(t, "", file)
+	assertDiagnostics(t, err, "test.proto: test.Example: generated identifier ExampleClient for this service client collides with message test.ExampleClient")
+	// Without clients there's nothing to collide with
+	generateFile(t, "services=false", "test.ts", file)
+}
+
+func TestNestedNamesDontCollide(t *testing.T) {
+	content := generateFile(t, "", "test.ts", proto3File(`
+message_type { name: "Foo" nested_type { name: "Bar" } }
+message_type { name: "Foo__Bar" }
+message_type { name: "a___b" }`))
+	assertContains(t, content,
+		"export class Foo__Bar extends Object",
+		"export class Foo$$Bar extends Object",
+		"export class a$$$b extends Object",
+	)
+}
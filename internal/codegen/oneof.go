@@ -0,0 +1,112 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Oneofs are generated as a single optional property holding a discriminated union, e.g.
+//
+// 	public choice?: { case: "first", value: string } | { case: "third", value: RootMessage__Stuff };
+//
+// The case tag is the JSON name of the active member, so only one member can ever be set on the typescript side.
+// google.protobuf.NullValue members are cases with the value null, e.g. { case: "none", value: null }.
+
+// jsonName converts a proto identifier to lowerCamelCase the same way protoc does when it populates json_name
+func jsonName(name string) string {
+	var builder strings.Builder
+	capitaliseNext := false
+	for _, r := range name {
+		switch {
+		case r == '_':
+			capitaliseNext = true
+		case capitaliseNext:
+			builder.WriteString(strings.ToUpper(string(r)))
+			capitaliseNext = false
+		default:
+			builder.WriteRune(r)
+		}
+	}
+	return builder.String()
+}
+
+// isOneofMember reports whether a field belongs to a real oneof, rather than the synthetic oneof protoc creates for a proto3 optional field
+func isOneofMember(field *descriptorpb.FieldDescriptorProto) bool {
+	return field.OneofIndex != nil && !field.GetProto3Optional()
+}
+
+// getOneofMembers returns all fields in the message which are members of the oneof at the specified index
+func getOneofMembers(msg *descriptorpb.DescriptorProto, index int32) (members []*descriptorpb.FieldDescriptorProto) {
+	for _, field := range msg.GetField() {
+		if isOneofMember(field) && field.GetOneofIndex() == index {
+			members = append(members, field)
+		}
+	}
+	return
+}
+
+// getOneofTypeName builds the union type for all members of a oneof, path is the location of the message used to find comments on each member.
+//
+// The union is written on one line unless a member has comments, then each case goes on its own line following its member's comments.
+// Either way the type starts with the whitespace separating it from the property name.
+func getOneofTypeName(msg *descriptorpb.DescriptorProto, index int32, types typeResolver, comments commentSet, path []int32) (string, error) {
+	var cases []string
+	commented := false
+	for i, member := range msg.GetField() {
+		if !isOneofMember(member) || member.GetOneofIndex() != index {
+			continue
+		}
+		memberType := "null"
+		if !isNullValue(member) {
+			var err error
+			memberType, err = getNativeTypeName(member, types)
+			if err != nil {
+				return "", fmt.Errorf("member %s: %v", member.GetName(), err)
+			}
+		}
+		memberComments := comments.generate(childPath(path, messageFieldPath, int32(i)), "		")
+		commented = commented || memberComments != ""
+		cases = append(cases, fmt.Sprintf(`%s		| { case: "%s", value: %s }`, memberComments, member.GetJsonName(), memberType))
+	}
+	if commented {
+		return "\n" + strings.Join(cases, "\n"), nil
+	}
+	for i, memberCase := range cases {
+		cases[i] = strings.TrimPrefix(memberCase, "		| ")
+	}
+	return " " + strings.Join(cases, " | "), nil
+}
+
+// generateOneofMarshalling creates the ToProtoJSON entries and the Parse statement for a whole oneof.
+//
+// ToProtoJSON writes every member, but only the active one will be defined, the rest are left undefined and are dropped by JSON.stringify.
+// Parse reads every member and then uses tsjson.Parse.Oneof to reject any input setting more than one of them.
+func generateOneofMarshalling(msg *descriptorpb.DescriptorProto, index int32, className string, types typeResolver) (toProtoJSON, parse string, err error) {
+	oneofName := jsonName(msg.GetOneofDecl()[index].GetName())
+	property := getOneofPropertyName(msg.GetOneofDecl()[index])
+	toProtoJSONContent := &strings.Builder{}
+	parseContent := &strings.Builder{}
+	parseContent.WriteString(fmt.Sprintf(`tsjson.Parse.Oneof<NonNullable<%s["%s"]>>("%s", [
+`, className, property, oneofName))
+	for _, member := range getOneofMembers(msg, index) {
+		var memberToProtoJSON, memberParse string
+		if isNullValue(member) {
+			// The member's only value is null, which Parse.NullValue distinguishes from the member being absent
+			memberToProtoJSON = "null"
+			memberParse = fmt.Sprintf(`tsjson.Parse.NullValue(objData, "%s", "%s")`, member.GetJsonName(), member.GetName())
+		} else {
+			memberToProtoJSON, memberParse, err = generateMarshallingStrings(member, types, fmt.Sprintf("this.%s.value", property), "objData")
+			if err != nil {
+				return "", "", fmt.Errorf("member %s: %v", member.GetName(), err)
+			}
+		}
+		toProtoJSONContent.WriteString(fmt.Sprintf(`			%s: this.%s?.case === "%s" ? %s : undefined,
+`, objectKey(member.GetJsonName()), property, member.GetJsonName(), memberToProtoJSON))
+		parseContent.WriteString(fmt.Sprintf(`			{ case: "%s", value: await %s },
+`, member.GetJsonName(), memberParse))
+	}
+	parseContent.WriteString(`		])`)
+	return toProtoJSONContent.String(), parseContent.String(), nil
+}
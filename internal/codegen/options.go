@@ -0,0 +1,200 @@
+package codegen
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const defaultRuntimePackage = "@llkennedy/protoc-gen-tsjson"
+
+// options holds all behaviour which can be configured through plugin parameters, e.g. --tsjson_opt=services=false,runtime_package=@acme/tsjson
+type options struct {
+	// runtimePackage is the npm package imported as "tsjson" (and "google") by every generated file
+	runtimePackage string
+	// services enables generation of service clients
+	services bool
+	// googlePackage is the npm package with the generated code for files in google packages other than google.protobuf which don't set their own tsjson options, e.g. google/type/money.proto
+	googlePackage string
+	// googleImportRoot is the directory of googlePackage those files are generated in
+	googleImportRoot string
+	// fileMappings maps proto file names to where their generated code is imported from, overriding their tsjson options
+	fileMappings map[string]importMapping
+	// packageMappings maps proto packages to the npm package and import root of all their files, overriding their tsjson options
+	packageMappings map[string]importMapping
+	// paths chooses where generated files are written
+	paths pathsMode
+	// barrels chooses which index.ts files are written
+	barrels barrelsMode
+}
+
+// pathsMode is how the path of each generated file within its npm package is chosen, which is both where it is written and where it is imported from
+type pathsMode string
+
+const (
+	// pathsImport uses the (tsjson.import_path) option of each file
+	pathsImport pathsMode = "import"
+	// pathsSourceRelative uses the path of the proto file, ignoring the import_path option
+	pathsSourceRelative pathsMode = "source_relative"
+	// pathsPackage puts every file in a directory named after its proto package, ignoring the import_path option
+	pathsPackage pathsMode = "package"
+)
+
+// barrelsMode is which index.ts files re-exporting generated code are written
+type barrelsMode string
+
+const (
+	barrelsNone barrelsMode = "none"
+	// barrelsDirectory writes one barrel per output directory, for the files directly in it
+	barrelsDirectory barrelsMode = "directory"
+	// barrelsPackage writes one barrel per proto package, in the directory named after the package
+	barrelsPackage barrelsMode = "package"
+	// barrelsAll writes both, a directory which is also a package's directory gets a single barrel for all of their files
+	barrelsAll barrelsMode = "all"
+)
+
+// importMapping is an npm package and a path within it set by an M or P parameter
+type importMapping struct {
+	npmPackage string
+	importPath string
+}
+
+// defaultOptions returns the options used when no parameters are provided
+func defaultOptions() options {
+	return options{
+		runtimePackage:  defaultRuntimePackage,
+		services:        true,
+		fileMappings:    map[string]importMapping{},
+		packageMappings: map[string]importMapping{},
+		paths:           pathsImport,
+		barrels:         barrelsNone,
+	}
+}
+
+// parseOptions parses comma separated key=value plugin parameters on top of the default options.
+//
+// Supported keys are:
+//   - runtime_package=<npm package>: the npm package providing the tsjson runtime, defaults to @llkennedy/protoc-gen-tsjson
+//   - services=<bool>: whether to generate service clients, defaults to true
+//   - google_package=<npm package>: the npm package google.* files without tsjson options are imported from, google.protobuf always comes from the runtime instead
+//   - google_import_root=<path>: the directory of google_package those files are generated in, defaults to its root
+//   - M<proto file>=<npm package>/<import path>: where the generated code for a proto file is imported from, e.g. Mvendor/foo.proto=@acme/foo/vendor/foo
+//   - P<proto package>=<npm package>[/<import root>]: the npm package for every file in a proto package, each generated at its proto file path under the import root, e.g. Pacme.billing=@acme/billing
+//   - paths=<mode>: import (the default) writes files at their import_path, source_relative at the path of their proto file, and package in one directory per proto package
+//   - barrels=<mode>: none (the default), directory, package or all, which index.ts files re-exporting the generated code are written, see barrels.go
+//
+// M parameters take precedence over P parameters, and both take precedence over the tsjson options of the files they match.
+func parseOptions(parameter string) (opts options, err error) {
+	opts = defaultOptions()
+	if parameter == "" {
+		return
+	}
+	for _, param := range strings.Split(parameter, ",") {
+		parts := strings.SplitN(param, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return opts, fmt.Errorf("malformed parameter %q, expected key=value", param)
+		}
+		key, value := parts[0], parts[1]
+		switch key {
+		case "runtime_package":
+			if value == "" {
+				return opts, fmt.Errorf("parameter %s must not be empty", key)
+			}
+			opts.runtimePackage = value
+		case "services":
+			opts.services, err = strconv.ParseBool(value)
+			if err != nil {
+				return opts, fmt.Errorf("parameter %s must be true or false, found %q", key, value)
+			}
+		case "paths":
+			switch mode := pathsMode(value); mode {
+			case pathsImport, pathsSourceRelative, pathsPackage:
+				opts.paths = mode
+			default:
+				return opts, fmt.Errorf("parameter %s must be one of %s, %s or %s, found %q", key, pathsImport, pathsSourceRelative, pathsPackage, value)
+			}
+		case "barrels":
+			switch mode := barrelsMode(value); mode {
+			case barrelsNone, barrelsDirectory, barrelsPackage, barrelsAll:
+				opts.barrels = mode
+			default:
+				return opts, fmt.Errorf("parameter %s must be one of %s, %s, %s or %s, found %q", key, barrelsNone, barrelsDirectory, barrelsPackage, barrelsAll, value)
+			}
+		case "google_package":
+			if len(value) > maxNpmPackageLength || !npmPackageName.MatchString(value) {
+				return opts, fmt.Errorf("parameter %s %q is not a valid npm package name", key, value)
+			}
+			opts.googlePackage = value
+		case "google_import_root":
+			if problem := checkImportPath(value); problem != "" {
+				return opts, fmt.Errorf("parameter %s %q %s", key, value, problem)
+			}
+			opts.googleImportRoot = value
+		default:
+			if err = parseMapping(opts, key, value); err != nil {
+				return opts, err
+			}
+		}
+	}
+	return
+}
+
+// parameterNames are the keys of every parameter other than M and P
+var parameterNames = []string{"runtime_package", "services", "paths", "barrels", "google_package", "google_import_root"}
+
+// protoPackageName matches a dotted proto package name, e.g. acme.billing.v1
+var protoPackageName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+// parseMapping parses an M or P parameter into opts
+func parseMapping(opts options, key, value string) error {
+	var mappings map[string]importMapping
+	// Keys are checked strictly enough that a misspelled parameter such as Paths=package isn't mistaken for a mapping
+	for _, parameterName := range parameterNames {
+		if strings.EqualFold(key, parameterName) {
+			return fmt.Errorf("unknown parameter %q, did you mean %s?", key, parameterName)
+		}
+	}
+	name := key[1:]
+	switch {
+	case strings.HasPrefix(key, "M") && strings.HasSuffix(name, ".proto") && len(name) > len(".proto"):
+		mappings = opts.fileMappings
+	case strings.HasPrefix(key, "P") && protoPackageName.MatchString(name):
+		mappings = opts.packageMappings
+	default:
+		return fmt.Errorf("unknown parameter %q", key)
+	}
+	if _, ok := mappings[name]; ok {
+		return fmt.Errorf("parameter %s is set more than once", key)
+	}
+	mapping := splitNpmPath(value)
+	if len(mapping.npmPackage) > maxNpmPackageLength || !npmPackageName.MatchString(mapping.npmPackage) {
+		return fmt.Errorf("parameter %s: %q is not a valid npm package name", key, mapping.npmPackage)
+	}
+	switch {
+	case mapping.importPath != "":
+		if problem := checkImportPath(mapping.importPath); problem != "" {
+			return fmt.Errorf("parameter %s: import path %q %s", key, mapping.importPath, problem)
+		}
+	case key[0] == 'M':
+		return fmt.Errorf("parameter %s must include an import path after the npm package, e.g. %s=%s/%s", key, key, mapping.npmPackage, filenameFromProto(name).fullWithoutExtension)
+	}
+	mappings[name] = mapping
+	return nil
+}
+
+// splitNpmPath splits a path such as @acme/foo/vendor/foo into the npm package, which may be scoped, and the path within it
+func splitNpmPath(value string) importMapping {
+	packageParts := 1
+	if strings.HasPrefix(value, "@") {
+		packageParts = 2
+	}
+	parts := strings.SplitN(value, "/", packageParts+1)
+	if len(parts) <= packageParts {
+		return importMapping{npmPackage: value}
+	}
+	return importMapping{
+		npmPackage: strings.Join(parts[:packageParts], "/"),
+		importPath: parts[packageParts],
+	}
+}
@@ -0,0 +1,140 @@
+package codegen
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseOptions(t *testing.T) {
+	tests := []struct {
+		name      string
+		parameter string
+		// want modifies the default options into the expected result, nil when an error is expected
+		want func(opts *options)
+	}{
+		{name: "empty", parameter: "", want: func(opts *options) {}},
+		{name: "runtime package", parameter: "runtime_package=@acme/tsjson", want: func(opts *options) { opts.runtimePackage = "@acme/tsjson" }},
+		{name: "services", parameter: "services=false", want: func(opts *options) { opts.services = false }},
+		{name: "paths", parameter: "paths=source_relative", want: func(opts *options) { opts.paths = pathsSourceRelative }},
+		{name: "barrels", parameter: "barrels=all", want: func(opts *options) { opts.barrels = barrelsAll }},
+		{name: "google", parameter: "google_package=@acme/googleapis,google_import_root=gen", want: func(opts *options) {
+			opts.googlePackage = "@acme/googleapis"
+			opts.googleImportRoot = "gen"
+		}},
+		{name: "file mapping", parameter: "Mvendor/foo.proto=@acme/foo/vendor/foo", want: func(opts *options) {
+			opts.fileMappings["vendor/foo.proto"] = importMapping{npmPackage: "@acme/foo", importPath: "vendor/foo"}
+		}},
+		{name: "package mapping", parameter: "Pacme.billing=@acme/billing", want: func(opts *options) {
+			opts.packageMappings["acme.billing"] = importMapping{npmPackage: "@acme/billing"}
+		}},
+		{name: "package mapping with root", parameter: "Pacme.billing=billing/gen", want: func(opts *options) {
+			opts.packageMappings["acme.billing"] = importMapping{npmPackage: "billing", importPath: "gen"}
+		}},
+		{name: "package named after a parameter", parameter: "Pservices=services", want: func(opts *options) {
+			opts.packageMappings["services"] = importMapping{npmPackage: "services"}
+		}},
+		{name: "several", parameter: "services=false,runtime_package=tsjson,paths=package,Pacme=acme", want: func(opts *options) {
+			opts.services = false
+			opts.runtimePackage = "tsjson"
+			opts.paths = pathsPackage
+			opts.packageMappings["acme"] = importMapping{npmPackage: "acme"}
+		}},
+		{name: "missing value", parameter: "services"},
+		{name: "missing key", parameter: "=true"},
+		{name: "unknown", parameter: "flat=true"},
+		{name: "wrong case", parameter: "Services=false"},
+		{name: "wrong case mistaken for a mapping", parameter: "Paths=package"},
+		{name: "bad bool", parameter: "services=maybe"},
+		{name: "bad paths", parameter: "paths=flat"},
+		{name: "bad barrels", parameter: "barrels=some"},
+		{name: "empty runtime package", parameter: "runtime_package="},
+		{name: "bad google package", parameter: "google_package=Acme"},
+		{name: "bad google import root", parameter: "google_import_root=/gen"},
+		{name: "file mapping without proto file", parameter: "Mfoo=acme/foo"},
+		{name: "file mapping without import path", parameter: "Mfoo.proto=acme"},
+		{name: "file mapping with bad import path", parameter: "Mfoo.proto=acme/foo.ts"},
+		{name: "bad package name", parameter: "P1acme=acme"},
+		{name: "bad npm package", parameter: "Pacme=Acme"},
+		{name: "duplicate mapping", parameter: "Pacme=acme,Pacme=other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseOptions(tt.parameter)
+			if tt.want == nil {
+				if err == nil {
+					t.Errorf("parseOptions(%q) succeeded, want an error", tt.parameter)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseOptions(%q) failed: %v", tt.parameter, err)
+			}
+			want := defaultOptions()
+			tt.want(&want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("parseOptions(%q) = %+v, want %+v", tt.parameter, got, want)
+			}
+		})
+	}
+}
+
+func TestOptionsAffectGeneratedCode(t *testing.T) {
+	file := proto3File(`
+message_type { name: "Req" }
+service {
+	name: "Example"
+	method { name: "Do" input_type: ".test.Req" output_type: ".test.Req" }
+}`)
+	content := generateFile(t, "", "test.ts", file)
+	assertContains(t, content, `import * as tsjson from "@llkennedy/protoc-gen-tsjson";`, "export class ExampleClient {")
+	content = generateFile(t, "runtime_package=@acme/tsjson,services=false", "test.ts", file)
+	assertContains(t, content, `import * as tsjson from "@acme/tsjson";`, "export class Req ")
+	assertNotContains(t, content, "@llkennedy/protoc-gen-tsjson", "ExampleClient")
+}
+
+func TestInvalidOptionsAreReported(t *testing.T) {
+	_, err := generate(t, "services=maybe", proto3File(`message_type { name: "Req" }`))
+	if err == nil || !strings.Contains(err.Error(), "services") {
+		t.Errorf("generation error = %v, want an error about the services parameter", err)
+	}
+}
+
+func TestMappings(t *testing.T) {
+	generated, err := generate(t, "Mvendor/foo.proto=@acme/foo/vendor/foo,Pacme.billing=@acme/billing/gen,Macme/billing/special.proto=@acme/special/special,Mown.proto=@acme/test/mapped/own",
+		`name: "vendor/foo.proto" package: "vendor" syntax: "proto3"
+message_type { name: "Foo" }`,
+		`name: "acme/billing/invoice.proto" package: "acme.billing" syntax: "proto3"
+message_type { name: "Invoice" }`,
+		`name: "acme/billing/special.proto" package: "acme.billing" syntax: "proto3"
+message_type { name: "Special" }`,
+		`name: "own.proto" package: "test" syntax: "proto3"
+options { [tsjson.npm_package]: "@acme/own" [tsjson.import_path]: "own" }
+message_type { name: "Own" }`,
+		proto3File(`dependency: ["vendor/foo.proto", "acme/billing/invoice.proto", "acme/billing/special.proto", "own.proto"]
+message_type {
+	name: "Example"
+	field { name: "foo" number: 1 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".vendor.Foo" }
+	field { name: "invoice" number: 2 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".acme.billing.Invoice" }
+	field { name: "special" number: 3 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".acme.billing.Special" }
+	field { name: "own" number: 4 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".test.Own" }
+}`))
+	if err != nil {
+		t.Fatalf("generation failed: %v", err)
+	}
+	// Mapped files are generated at their mapped import path
+	for _, name := range []string{"vendor/foo.ts", "gen/acme/billing/invoice.ts", "special.ts", "mapped/own.ts", "test.ts"} {
+		if _, ok := generated[name]; !ok {
+			t.Errorf("%s was not generated", name)
+		}
+	}
+	assertContains(t, generated["test.ts"],
+		"} from \"@acme/foo/vendor/foo\";",
+		// A package mapping puts each file at its proto path under the import root
+		"} from \"@acme/billing/gen/acme/billing/invoice\";",
+		// A file mapping takes precedence over a package mapping
+		"} from \"@acme/special/special\";",
+		// and over the file's own options, here moving it into the same npm package
+		"} from \"./mapped/own\";",
+	)
+}
@@ -0,0 +1,27 @@
+package codegen
+
+import "google.golang.org/protobuf/types/descriptorpb"
+
+// hasPresence reports whether a singular field tracks presence explicitly, in which case a field set to its zero value is distinct from an unset field.
+//
+// Fields with explicit presence are written by ToProtoJSON whenever they are set, while fields with implicit presence omit their zero value,
+// matching canonical protojson output where the two cases cannot be told apart anyway.
+func hasPresence(field *descriptorpb.FieldDescriptorProto, features resolvedFeatures) bool {
+	switch {
+	case field.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED:
+		return false
+	case field.GetType() == descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, field.GetType() == descriptorpb.FieldDescriptorProto_TYPE_GROUP:
+		return true
+	case field.OneofIndex != nil:
+		// Both real oneof members and proto3 optional fields (which are members of a synthetic oneof)
+		return true
+	default:
+		// Explicit for proto2 and editions by default, implicit for proto3, legacy required fields always have presence
+		return features.fieldPresence != descriptorpb.FeatureSet_IMPLICIT
+	}
+}
+
+// isRequired reports whether a field must be present when parsing, either as a proto2 required field or through the equivalent editions feature
+func isRequired(field *descriptorpb.FieldDescriptorProto, features resolvedFeatures) bool {
+	return field.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REQUIRED || features.fieldPresence == descriptorpb.FeatureSet_LEGACY_REQUIRED
+}
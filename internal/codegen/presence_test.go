@@ -0,0 +1,52 @@
+package codegen
+
+import "testing"
+
+func TestImplicitPresence(t *testing.T) {
+	content := generateFile(t, "", "test.ts", proto3File(`
+message_type {
+	name: "Example"
+	field { name: "count" number: 1 label: LABEL_OPTIONAL type: TYPE_INT32 }
+	field { name: "maybe" number: 2 label: LABEL_OPTIONAL type: TYPE_INT32 oneof_index: 0 proto3_optional: true }
+	field { name: "data" number: 3 label: LABEL_OPTIONAL type: TYPE_BYTES }
+	field { name: "kind" number: 4 label: LABEL_OPTIONAL type: TYPE_ENUM type_name: ".test.Kind" }
+	field { name: "child" number: 5 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".test.Example" }
+	field { name: "counts" number: 6 label: LABEL_REPEATED type: TYPE_INT32 }
+	oneof_decl { name: "_maybe" }
+}
+enum_type { name: "Kind" value { name: "KIND_UNKNOWN" number: 0 } }`))
+	assertContains(t, content,
+		// Zero values of implicit presence fields are dropped
+		"count: tsjson.ToProtoJSON.Number(tsjson.ToProtoJSON.NonZero(this.count)),",
+		"data: tsjson.ToProtoJSON.Bytes(tsjson.ToProtoJSON.NonZero(this.data)),",
+		"kind: tsjson.ToProtoJSON.Enum(Kind, tsjson.ToProtoJSON.NonZero(this.kind)),",
+		// proto3 optional fields are plain properties, not a oneof, and keep their zero values
+		"public maybe?: number;",
+		"maybe: tsjson.ToProtoJSON.Number(this.maybe),",
+		`res.maybe = await tsjson.Parse.Number(objData, "maybe", "maybe");`,
+		// Messages always have presence, and repeated fields have none to track
+		"child: this.child?.ToProtoJSON(),",
+		"counts: tsjson.ToProtoJSON.Repeated(tsjson.ToProtoJSON.Number, this.counts),",
+	)
+	assertNotContains(t, content, "_maybe")
+}
+
+func TestPresenceBySyntax(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		want string
+	}{
+		{name: "proto2 optional", file: `name: "test.proto" package: "test" syntax: "proto2"
+options { [tsjson.npm_package]: "@acme/test" [tsjson.import_path]: "test" }
+message_type {
+	name: "Example"
+	field { name: "count" number: 1 label: LABEL_OPTIONAL type: TYPE_INT32 }
+}`, want: "count: tsjson.ToProtoJSON.Number(this.count),"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertContains(t, generateFile(t, "", "test.ts", tt.file), tt.want)
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package codegen
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Proto2 files share the protojson mapping with proto3, the differences are driven by resolved features (see features.go) so they apply equally to editions:
+//   - every singular field has explicit presence (see hasPresence)
+//   - required fields must be present when parsing (see isRequired)
+//   - fields may declare explicit default values, exposed as a static Defaults object on the message class, except for oneof members
+//   - enums are closed, so unknown numeric values are rejected when parsing
+
+// generateDefaults writes the static Defaults object for any fields with explicit default values, if there are any. Path is the location path of the message.
+func generateDefaults(msg *descriptorpb.DescriptorProto, types typeResolver, content *strings.Builder, diags *fileDiagnostics, path []int32) {
+	defaults := &strings.Builder{}
+	for _, field := range msg.GetField() {
+		// Oneof members have no property of their own to give a default to, the oneof property is simply unset until a member is chosen
+		if field.DefaultValue == nil || isOneofMember(field) {
+			continue
+		}
+		// Any problem resolving the field type has already been reported when its property was declared
+		tsType, err := getNativeTypeName(field, types)
+		if err != nil {
+			continue
+		}
+		defaults.WriteString(fmt.Sprintf("		%s: %s as %s,\n", objectKey(getPropertyName(field)), getDefaultValue(field, tsType), tsType))
+	}
+	if defaults.Len() == 0 {
+		return
+	}
+	content.WriteString(fmt.Sprintf("	/** Default values of fields which declare them explicitly, for use when the field is unset */\n	public static readonly Defaults = {\n%s	};\n", defaults.String()))
+}
+
+// getDefaultValue converts the text form of a default value in a field descriptor to a typescript literal, tsType is the type of the field's property
+func getDefaultValue(field *descriptorpb.FieldDescriptorProto, tsType string) string {
+	value := field.GetDefaultValue()
+	switch field.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_STRING:
+		quoted, _ := json.Marshal(value)
+		return string(quoted)
+	case descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		data := unescapeBytes(value)
+		parts := make([]string, len(data))
+		for i, b := range data {
+			parts[i] = strconv.Itoa(int(b))
+		}
+		return fmt.Sprintf("new Uint8Array([%s])", strings.Join(parts, ", "))
+	case descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		return fmt.Sprintf("%s.%s", tsType, value)
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		return value
+	default:
+		// Numbers, including the special floating point values
+		switch value {
+		case "inf":
+			return "Infinity"
+		case "-inf":
+			return "-Infinity"
+		case "nan":
+			return "NaN"
+		default:
+			return value
+		}
+	}
+}
+
+// unescapeBytes reverses the C-style escaping protoc applies to bytes default values
+func unescapeBytes(value string) []byte {
+	out := make([]byte, 0, len(value))
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i+1 >= len(value) {
+			out = append(out, value[i])
+			continue
+		}
+		i++
+		switch c := value[i]; c {
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case 'x':
+			// One or two hex digits
+			end := i + 1
+			for end < len(value) && end < i+3 && strings.ContainsRune("0123456789abcdefABCDEF", rune(value[end])) {
+				end++
+			}
+			parsed, _ := strconv.ParseUint(value[i+1:end], 16, 8)
+			out = append(out, byte(parsed))
+			i = end - 1
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			// Up to three octal digits
+			end := i
+			for end < len(value) && end < i+3 && value[end] >= '0' && value[end] <= '7' {
+				end++
+			}
+			parsed, _ := strconv.ParseUint(value[i:end], 8, 8)
+			out = append(out, byte(parsed))
+			i = end - 1
+		default:
+			// Quotes, backslashes and anything else escaped unnecessarily
+			out = append(out, c)
+		}
+	}
+	return out
+}
@@ -0,0 +1,84 @@
+package codegen
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestUnescapeBytes(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  []byte
+	}{
+		{name: "plain", value: "abc", want: []byte("abc")},
+		{name: "empty", value: "", want: []byte{}},
+		{name: "control characters", value: `a\nb\rc\td`, want: []byte("a\nb\rc\td")},
+		{name: "hex", value: `\x41\x4a`, want: []byte("AJ")},
+		{name: "single hex digit", value: `\x4g`, want: []byte{0x04, 'g'}},
+		{name: "hex stops after two digits", value: `\x414`, want: []byte("A4")},
+		{name: "octal", value: `\101\0`, want: []byte{'A', 0}},
+		{name: "octal stops after three digits", value: `\1234`, want: []byte("S4")},
+		{name: "highest octal", value: `\377`, want: []byte{0xff}},
+		{name: "octal stops at non octal digit", value: `\18`, want: []byte{0x01, '8'}},
+		{name: "quotes and backslashes", value: `\"\'\\`, want: []byte(`"'\`)},
+		{name: "trailing backslash", value: `a\`, want: []byte(`a\`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unescapeBytes(tt.value); !bytes.Equal(got, tt.want) {
+				t.Errorf("unescapeBytes(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+// proto2File is a text format proto2 file named test.proto in package test, with the tsjson options set, body holds its messages and enums
+func proto2File(body string) string {
+	return `name: "test.proto" package: "test" syntax: "proto2"
+options { [tsjson.npm_package]: "@acme/test" [tsjson.import_path]: "test" }
+` + body
+}
+
+func TestDefaults(t *testing.T) {
+	content := generateFile(t, "", "test.ts", proto2File(`
+message_type {
+	name: "Legacy"
+	field { name: "name" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING default_value: "say \"hi\"" }
+	field { name: "data" number: 2 label: LABEL_OPTIONAL type: TYPE_BYTES default_value: "A\\001" }
+	field { name: "kind" number: 3 label: LABEL_OPTIONAL type: TYPE_ENUM type_name: ".test.Kind" default_value: "KIND_B" }
+	field { name: "ratio" number: 4 label: LABEL_OPTIONAL type: TYPE_DOUBLE default_value: "-inf" }
+	field { name: "flag" number: 5 label: LABEL_OPTIONAL type: TYPE_BOOL default_value: "true" }
+	field { name: "plain" number: 6 label: LABEL_OPTIONAL type: TYPE_INT32 }
+	field { name: "oa" number: 7 label: LABEL_OPTIONAL type: TYPE_STRING default_value: "a" oneof_index: 0 }
+	field { name: "ob" number: 8 label: LABEL_OPTIONAL type: TYPE_INT32 default_value: "2" oneof_index: 0 }
+	oneof_decl { name: "choice" }
+}
+enum_type {
+	name: "Kind"
+	value { name: "KIND_A" number: 1 }
+	value { name: "KIND_B" number: 2 }
+}`))
+	assertContains(t, content,
+		"\tpublic static readonly Defaults = {\n"+
+			"\t\tname: \"say \\\"hi\\\"\" as string,\n"+
+			"\t\tdata: new Uint8Array([65, 1]) as Uint8Array,\n"+
+			"\t\tkind: Kind.KIND_B as Kind,\n"+
+			"\t\tratio: -Infinity as number,\n"+
+			"\t\tflag: true as boolean,\n"+
+			"\t};\n",
+		// proto2 enums are closed
+		`res.kind = await tsjson.Parse.Enum(objData, "kind", "kind", Kind, false);`,
+	)
+}
+
+func TestNoDefaults(t *testing.T) {
+	content := generateFile(t, "", "test.ts", proto2File(`
+message_type {
+	name: "Legacy"
+	field { name: "oa" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING default_value: "a" oneof_index: 0 }
+	field { name: "plain" number: 2 label: LABEL_OPTIONAL type: TYPE_INT32 }
+	oneof_decl { name: "choice" }
+}`))
+	assertNotContains(t, content, "Defaults")
+}
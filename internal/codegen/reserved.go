@@ -0,0 +1,110 @@
+package codegen
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Proto names which would break or change the meaning of the generated code are escaped by appending an underscore, e.g. a field named delete becomes the property delete_.
+// Mangled type names never end in an underscore (see naming.go) and protoc never generates JSON names ending in one, so escaped names can't collide with anything else unless a json_name option is set to match.
+// Only the typescript side is escaped, JSON keys on the wire are always the original json_name.
+
+const escapeSuffix = "_"
+
+// reservedWords are javascript reserved words, including those only reserved in strict mode. None of them are used as generated names
+var reservedWords = stringSet(
+	"break", "case", "catch", "class", "const", "continue", "debugger", "default", "delete", "do", "else", "enum", "export", "extends", "false", "finally", "for", "function", "if", "import", "in", "instanceof", "new", "null", "return", "super", "switch", "this", "throw", "true", "try", "typeof", "var", "void", "while", "with",
+	"implements", "interface", "let", "package", "private", "protected", "public", "static", "yield", "await",
+)
+
+// reservedTypeNames can't be declared as classes or enums, or would shadow globals used by generated code (or commonly used alongside it) and the names the runtime is imported as
+var reservedTypeNames = stringSet(
+	// Typescript predefined types and names which can't be bound in strict mode
+	"any", "bigint", "boolean", "never", "number", "object", "string", "symbol", "undefined", "unknown", "arguments", "eval",
+	"Object", "Map", "ReadonlyMap", "Promise", "Date", "Array", "Uint8Array", "JSON", "Error", "Symbol", "String", "Number", "Boolean", "NonNullable", "AsyncIterable", "Infinity", "NaN",
+	"tsjson", "google",
+)
+
+// reservedMembers are instance members of every generated message class, either generated alongside the fields or inherited from Object.
+// Static members (Parse and Defaults) live on the class itself, so properties are free to share their names.
+var reservedMembers = stringSet(
+	"constructor", "__proto__", "ToProtoJSON",
+	"toString", "toLocaleString", "valueOf", "hasOwnProperty", "isPrototypeOf", "propertyIsEnumerable", "__defineGetter__", "__defineSetter__", "__lookupGetter__", "__lookupSetter__",
+)
+
+// reservedClientMembers are instance members of every generated service client class
+var reservedClientMembers = stringSet(
+	"constructor", "__proto__", "transport",
+	"toString", "toLocaleString", "valueOf", "hasOwnProperty", "isPrototypeOf", "propertyIsEnumerable", "__defineGetter__", "__defineSetter__", "__lookupGetter__", "__lookupSetter__",
+)
+
+func stringSet(values ...string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
+
+// escapeTypeName escapes the name of a generated class or enum
+func escapeTypeName(name string) string {
+	if reservedWords[name] || reservedTypeNames[name] {
+		return name + escapeSuffix
+	}
+	return name
+}
+
+// escapePropertyName escapes the name of a property of a generated message class
+func escapePropertyName(name string) string {
+	if reservedWords[name] || reservedMembers[name] {
+		return name + escapeSuffix
+	}
+	return name
+}
+
+// escapeMethodName escapes the name of a method of a generated service client
+func escapeMethodName(name string) string {
+	if reservedWords[name] || reservedClientMembers[name] {
+		return name + escapeSuffix
+	}
+	return name
+}
+
+// getPropertyName is the name of the property generated for a field.
+// Custom JSON names may not be identifiers, so properties must be declared with objectKey and accessed with memberAccess.
+func getPropertyName(field *descriptorpb.FieldDescriptorProto) string {
+	return escapePropertyName(field.GetJsonName())
+}
+
+// getOneofPropertyName is the name of the property generated for a oneof
+func getOneofPropertyName(oneof *descriptorpb.OneofDescriptorProto) string {
+	return escapePropertyName(jsonName(oneof.GetName()))
+}
+
+var plainIdentifier = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// objectKey writes a name as a key in an object literal or class body.
+// __proto__ has to be computed, otherwise it sets the prototype of the object rather than adding a key, and custom JSON names which aren't identifiers are quoted.
+func objectKey(key string) string {
+	quoted, _ := json.Marshal(key)
+	switch {
+	case key == "__proto__":
+		return "[" + string(quoted) + "]"
+	case plainIdentifier.MatchString(key):
+		return key
+	default:
+		return string(quoted)
+	}
+}
+
+// memberAccess writes an expression reading the named property of an object
+func memberAccess(object, property string) string {
+	if plainIdentifier.MatchString(property) {
+		return object + "." + property
+	}
+	quoted, _ := json.Marshal(property)
+	return fmt.Sprintf("%s[%s]", object, quoted)
+}
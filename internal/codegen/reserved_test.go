@@ -0,0 +1,53 @@
+package codegen
+
+import "testing"
+
+func TestReservedNamesAreEscaped(t *testing.T) {
+	content := generateFile(t, "", "test.ts", proto3File(`
+message_type {
+	name: "Example"
+	field { name: "delete" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING }
+	field { name: "constructor" number: 2 label: LABEL_OPTIONAL type: TYPE_STRING }
+	field { name: "__proto__" number: 3 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "__proto__" }
+	field { name: "ToProtoJSON" number: 4 label: LABEL_OPTIONAL type: TYPE_STRING }
+	field { name: "toString" number: 5 label: LABEL_OPTIONAL type: TYPE_STRING }
+}
+message_type { name: "Object" }
+message_type { name: "tsjson" }
+service {
+	name: "Svc"
+	method { name: "transport" input_type: ".test.Example" output_type: ".test.Example" }
+}`))
+	assertContains(t, content,
+		"public delete_?: string;",
+		"public constructor_?: string;",
+		"public __proto___?: string;",
+		"public ToProtoJSON_?: string;",
+		"public toString_?: string;",
+		// JSON keys are never escaped
+		`delete: tsjson.ToProtoJSON.String(tsjson.ToProtoJSON.NonZero(this.delete_)),`,
+		`res.ToProtoJSON_ = await tsjson.Parse.String(objData, "ToProtoJSON", "ToProtoJSON");`,
+		"export class Object_ extends Object",
+		"export class tsjson_ extends Object",
+		"public async transport_(",
+	)
+}
+
+// Static members of the class don't share a namespace with the properties of its instances
+func TestStaticMemberNamesAreNotEscaped(t *testing.T) {
+	content := generateFile(t, "", "test.ts", proto2File(`
+message_type {
+	name: "Example"
+	field { name: "Parse" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING default_value: "p" }
+	field { name: "Defaults" number: 2 label: LABEL_OPTIONAL type: TYPE_STRING }
+	field { name: "prototype" number: 3 label: LABEL_OPTIONAL type: TYPE_STRING }
+}`))
+	assertContains(t, content,
+		"public Parse?: string;",
+		"public Defaults?: string;",
+		"public prototype?: string;",
+		`res.Parse = await tsjson.Parse.String(objData, "Parse", "Parse");`,
+		"public static async Parse(data: any): Promise<Example> {",
+		"\t\tParse: \"p\" as string,\n",
+	)
+}
@@ -2,11 +2,10 @@ package codegen
 
 import (
 	"fmt"
-	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/LLKennedy/protoc-gen-tsjson/internal/version"
-	"github.com/LLKennedy/protoc-gen-tsjson/tsjsonpb"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/descriptorpb"
 	"google.golang.org/protobuf/types/pluginpb"
@@ -14,10 +13,8 @@ import (
 
 var protocVersion = "unknown"
 
-var packageReplacement = regexp.MustCompile(`\.([a-zA-Z0-9_]+)\.(.*)`)
-
-// At time of writing, the only feature that can be marked as supported is restoring the "optional" keyword to proto3, still an experimental feature that is out of scope for this project.
-var support uint64 = uint64(pluginpb.CodeGeneratorResponse_FEATURE_NONE)
+// Proto3 optional fields are supported by generating explicit presence for them, see hasPresence. Editions are supported through feature resolution, see features.go
+var support uint64 = uint64(pluginpb.CodeGeneratorResponse_FEATURE_PROTO3_OPTIONAL | pluginpb.CodeGeneratorResponse_FEATURE_SUPPORTS_EDITIONS)
 
 // Run performs code generation on the input data
 func Run(request *pluginpb.CodeGeneratorRequest) (response *pluginpb.CodeGeneratorResponse) {
@@ -25,26 +22,36 @@ func Run(request *pluginpb.CodeGeneratorRequest) (response *pluginpb.CodeGenerat
 		if r := recover(); r != nil {
 			response = &pluginpb.CodeGeneratorResponse{
 				SupportedFeatures: &support,
+				MinimumEdition:    proto.Int32(int32(minimumEdition)),
+				MaximumEdition:    proto.Int32(int32(maximumEdition)),
 				Error:             proto.String(fmt.Sprintf("caught panic in protoc-gen-tsjson: %v", r)),
 			}
 		}
 	}()
 	// Set runtime version of protoc
 	protocVersion = version.FormatProtocVersion(request.GetCompilerVersion())
-	// Create a basic response with our feature support (none, see above)
+	// Create a basic response with our feature support (see above)
 	response = &pluginpb.CodeGeneratorResponse{
 		SupportedFeatures: &support,
+		MinimumEdition:    proto.Int32(int32(minimumEdition)),
+		MaximumEdition:    proto.Int32(int32(maximumEdition)),
 	}
 	// Make sure the request actually exists as a safeguard
 	if request == nil {
 		response.Error = proto.String("cannot generate from nil input")
 		return
 	}
+	// Parse any plugin parameters passed with --tsjson_opt
+	opts, err := parseOptions(request.GetParameter())
+	if err != nil {
+		response.Error = proto.String(fmt.Sprintf("invalid plugin parameters: %v", err))
+		return
+	}
 	// Generate the files (do the thing)
-	generatedFiles, err := generateAllFiles(request)
+	generatedFiles, err := generateAllFiles(request, opts)
 	if err != nil {
-		// It didn't work, ignore any data we generated and only return the error
-		response.Error = proto.String(fmt.Sprintf("failed to generate files: %v", err))
+		// It didn't work, ignore any data we generated and only return the diagnostics, which are already formatted one per line like compiler errors
+		response.Error = proto.String(err.Error())
 		return
 	}
 	// It worked, set the response data
@@ -55,146 +62,115 @@ func Run(request *pluginpb.CodeGeneratorRequest) (response *pluginpb.CodeGenerat
 const googlePrefix = "google."
 const googleProtobufPrefix = "google.protobuf"
 
-type exportDetails struct {
-	npmPackage   string
-	importPath   string
-	protoPackage string
-}
-
-// Naive approach to codegen, creates output files for every message/service in every linked file, not just the parts depended on by the "to generate" files
-func generateAllFiles(request *pluginpb.CodeGeneratorRequest) (outfiles []*pluginpb.CodeGeneratorResponse_File, err error) {
-	var out *pluginpb.CodeGeneratorResponse_File
-	var impexp importsExports
-	impexp, err = buildImportsAndTypes(request.GetProtoFile())
-	if err != nil {
+// Naive approach to codegen, creates output files for every message/service in every linked file, not just the parts depended on by the "to generate" files.
+// Every problem found along the way is collected, the error lists all of them (see diagnostics.go).
+func generateAllFiles(request *pluginpb.CodeGeneratorRequest, opts options) (outfiles []*pluginpb.CodeGeneratorResponse_File, err error) {
+	diags := &diagnostics{}
+	validateFiles(request.GetProtoFile(), opts, diags)
+	if err = diags.err(); err != nil {
+		// Bad options make the import details of files unreliable, so there's no point looking at types yet
 		return nil, err
 	}
+	symbols := buildSymbolTable(request.GetProtoFile(), opts, diags)
+	if err = diags.err(); err != nil {
+		// Generating from incomplete type information would only repeat the same problems in every file referring to the broken types
+		return nil, err
+	}
+	// Map of output files to the proto files generating them, by lower case name so files differing only by case don't overwrite each other on case insensitive file systems
+	outputs := map[string]string{}
+	var generated []*descriptorpb.FileDescriptorProto
 	for _, file := range request.GetProtoFile() {
 		for _, toGen := range request.GetFileToGenerate() {
 			if file.GetName() == toGen {
-				out, err = generateFullFile(file, impexp)
-				if err != nil {
-					return
+				out := generateFullFile(file, symbols, opts, diags.forFile(file))
+				if out == nil {
+					break
+				}
+				key := strings.ToLower(out.GetName())
+				if other, ok := outputs[key]; ok {
+					diags.forFile(file).add(nil, "output file %s is also generated from %s", out.GetName(), other)
+					break
 				}
+				outputs[key] = file.GetName()
 				outfiles = append(outfiles, out)
+				generated = append(generated, file)
 				break
 			}
 		}
 	}
-	return
-}
-
-type importsExports struct {
-	exportMap   map[string]exportDetails
-	typeMap     map[string]map[string]exportDetails
-	fileTypeMap map[string][]string
-}
-
-func buildImportsAndTypes(files []*descriptorpb.FileDescriptorProto) (impexp importsExports, err error) {
-	// Map of file names to input paths
-	impexp.exportMap = make(map[string]exportDetails, len(files))
-	// Map of package names to type names to import details
-	impexp.typeMap = make(map[string]map[string]exportDetails, len(files)) // Length here is just a starting value, not expected to be accurate
-	// Map of file names to type names
-	impexp.fileTypeMap = make(map[string][]string, len(files))
-	// Map of
-	// Check all files except google ones have both npm_package and import_path options set
-	for _, file := range files {
-		fileName := file.GetName()
-		pkgName := file.GetPackage()
-		if len(pkgName) >= len(googlePrefix) && pkgName[:len(googlePrefix)] == googlePrefix {
-			// Google files are allowed to not have the options, we handle them differently
-			continue
-		}
-		npmPackage, ok := proto.GetExtension(file.GetOptions(), tsjsonpb.E_NpmPackage).(string)
-		if !ok || npmPackage == "" {
-			err = fmt.Errorf("all imported files must specify the option (tsjson.npm_package), file %s did not", fileName)
-		}
-		importPath, _ := proto.GetExtension(file.GetOptions(), tsjsonpb.E_ImportPath).(string)
-		pkg := file.GetPackage()
-		details := exportDetails{
-			npmPackage:   npmPackage,
-			importPath:   importPath,
-			protoPackage: pkg,
-		}
-		impexp.exportMap[fileName] = details
-		pkgTypes, ok := impexp.typeMap[pkg]
-		if !ok {
-			pkgTypes = make(map[string]exportDetails, len(file.GetEnumType())+len(file.GetMessageType()))
-			impexp.typeMap[pkg] = pkgTypes
-		}
-		// Map out type defintions to packages for lookup later
-		for _, enum := range file.GetEnumType() {
-			parsedName := strings.ReplaceAll(enum.GetName(), ".", "__")
-			pkgTypes[parsedName] = details
-			impexp.fileTypeMap[fileName] = append(impexp.fileTypeMap[fileName], parsedName)
-		}
-		for _, msg := range file.GetMessageType() {
-			parsedName := strings.ReplaceAll(msg.GetName(), ".", "__")
-			pkgTypes[parsedName] = details
-			impexp.fileTypeMap[fileName] = append(impexp.fileTypeMap[fileName], parsedName)
-			for _, innerMsg := range msg.GetNestedType() {
-				innerName := fmt.Sprintf("%s__%s", parsedName, strings.ReplaceAll(innerMsg.GetName(), ".", "__"))
-				pkgTypes[innerName] = details
-				impexp.fileTypeMap[fileName] = append(impexp.fileTypeMap[fileName], innerName)
-			}
-		}
+	outfiles = append(outfiles, generateBarrels(generated, symbols, opts, outputs, diags)...)
+	if err = diags.err(); err != nil {
+		return nil, err
 	}
-	return impexp, nil
+	return outfiles, nil
 }
 
-func generateFullFile(f *descriptorpb.FileDescriptorProto, impexp importsExports) (out *pluginpb.CodeGeneratorResponse_File, err error) {
+// generateFullFile creates the output for a single proto file, any problems are reported to diags. Nothing is returned if the file can't be generated at all.
+func generateFullFile(f *descriptorpb.FileDescriptorProto, symbols symbolTable, opts options, diags *fileDiagnostics) (out *pluginpb.CodeGeneratorResponse_File) {
 	fileName := f.GetName()
-	if f.GetSyntax() != "proto3" {
-		err = fmt.Errorf("proto3 is the only syntax supported by protoc-gen-tsjson, found %s in %s", f.GetSyntax(), fileName)
-		return
-	}
-	parsedName := filenameFromProto(fileName)
-	details, _ := impexp.exportMap[fileName]
-	outName := details.importPath
-	if outName == "" {
-		outName = parsedName.fullWithoutExtension
+	features, err := getFileFeatures(f)
+	if err != nil {
+		diags.add(nil, "%v", err)
+		return nil
 	}
+	location := getFileLocation(f, opts)
 	out = &pluginpb.CodeGeneratorResponse_File{
-		Name: proto.String(outName + ".ts"),
+		Name: proto.String(location.importPath + ".ts"),
 	}
 	content := &strings.Builder{}
 	content.WriteString(getCodeGenmarker(version.GetVersionString(), protocVersion, fileName))
 	// Imports
-	generateImports(f, content, impexp)
-	// Enums
-	generateEnums(f.GetEnumType(), content)
+	types := typeResolver{symbols: symbols, file: fileName, location: location}
+	checkIdentifierCollisions(f, types, opts, diags)
+	generateImports(f, content, types, opts, diags)
+	// Comments are looked up by path as each element is generated
+	comments := buildCommentSet(f.GetSourceCodeInfo())
+	// Enums, including those nested in messages, come first so they are always declared before any message default values refer to them
+	protoPrefix := ""
+	if f.GetPackage() != "" {
+		protoPrefix = "." + f.GetPackage()
+	}
+	generateEnums(f.GetEnumType(), content, protoPrefix, types, comments, []int32{fileEnumTypePath})
+	generateNestedEnums(f.GetMessageType(), content, protoPrefix, types, comments, []int32{fileMessageTypePath})
 	// Messages
-	exports, _ := impexp.fileTypeMap[fileName]
-	generateMessages(f.GetMessageType(), content, f.GetPackage(), exports)
-	// Comments? unclear how to link them back to other elements
-	generateComments(f.GetSourceCodeInfo(), content)
+	generateMessages(f.GetMessageType(), content, protoPrefix, types, features, comments, diags, []int32{fileMessageTypePath})
+	// Services
+	if opts.services {
+		generateServices(f.GetService(), content, f.GetPackage(), types, comments, diags, []int32{fileServicePath})
+	}
 	out.Content = proto.String(content.String())
 	return
 }
 
-func generateImports(f *descriptorpb.FileDescriptorProto, content *strings.Builder, impexp importsExports) {
-	if len(f.GetMessageType()) > 0 {
-		// All messages need the common imports
-		content.WriteString("import * as tsjson from \"@llkennedy/protoc-gen-tsjson\";\n")
+func generateImports(f *descriptorpb.FileDescriptorProto, content *strings.Builder, types typeResolver, opts options, diags *fileDiagnostics) {
+	generateServices := opts.services && len(f.GetService()) > 0
+	if len(f.GetMessageType()) > 0 || generateServices {
+		// All messages and services need the common imports
+		content.WriteString(fmt.Sprintf("import * as tsjson from \"%s\";\n", opts.runtimePackage))
 	}
 	importMap := make(map[string][]string)
 	useGoogle := false
-	for _, msg := range f.GetMessageType() {
-		useGoogle = generateImportsForMessage(f, msg, importMap, content, impexp) || useGoogle
+	for i, msg := range f.GetMessageType() {
+		useGoogle = generateImportsForMessage(f, msg, importMap, content, types, diags, []int32{fileMessageTypePath, int32(i)}) || useGoogle
 	}
-	if useGoogle {
-		content.WriteString("import { google } from \"@llkennedy/protoc-gen-tsjson\";\n")
+	if generateServices {
+		for i, service := range f.GetService() {
+			useGoogle = generateImportsForService(f, service, importMap, types, diags, []int32{fileServicePath, int32(i)}) || useGoogle
+		}
 	}
-	prefix := "./"
-	currentParts := strings.Split(f.GetName(), "/")
-	if len(currentParts) > 1 {
-		prefix = ""
+	if useGoogle {
+		content.WriteString(fmt.Sprintf("import { google } from \"%s\";\n", opts.runtimePackage))
 	}
-	for i := 1; i < len(currentParts); i++ {
-		prefix += "../"
+	// Output must be byte-identical for identical input, so imports are written in a stable order rather than map order:
+	// the runtime imports first, then one statement per module sorted by module path, with the names in each statement sorted too
+	importPaths := make([]string, 0, len(importMap))
+	for importPath := range importMap {
+		importPaths = append(importPaths, importPath)
 	}
-	for importPath, imports := range importMap {
+	sort.Strings(importPaths)
+	for _, importPath := range importPaths {
+		imports := importMap[importPath]
+		sort.Strings(imports)
 		fullImportList := &strings.Builder{}
 		for i, imp := range imports {
 			if i != 0 {
@@ -203,148 +179,151 @@ func generateImports(f *descriptorpb.FileDescriptorProto, content *strings.Build
 			fullImportList.WriteString("\n	")
 			fullImportList.WriteString(imp)
 		}
-		content.WriteString(fmt.Sprintf("import { %s\n} from \"%s%s\";\n", fullImportList.String(), prefix, importPath))
+		content.WriteString(fmt.Sprintf("import { %s\n} from \"%s\";\n", fullImportList.String(), importPath))
 	}
 	content.WriteString("\n")
 }
 
-func generateImportsForMessage(f *descriptorpb.FileDescriptorProto, msg *descriptorpb.DescriptorProto, importMap map[string][]string, content *strings.Builder, impexp importsExports) (useGoogle bool) {
-	fileName := f.GetName()
-	for _, innerMsg := range msg.GetNestedType() {
+// generateImportsForMessage adds the imports for every field type in the message and its nested messages to the import map, path is the location path of the message
+func generateImportsForMessage(f *descriptorpb.FileDescriptorProto, msg *descriptorpb.DescriptorProto, importMap map[string][]string, content *strings.Builder, types typeResolver, diags *fileDiagnostics, path []int32) (useGoogle bool) {
+	for i, innerMsg := range msg.GetNestedType() {
 		// Recurse
-		generateImportsForMessage(f, innerMsg, importMap, content, impexp)
+		useGoogle = generateImportsForMessage(f, innerMsg, importMap, content, types, diags, childPath(path, messageNestedTypePath, int32(i))) || useGoogle
 	}
-FIELD_IMPORT_LOOP:
-	for _, field := range msg.GetField() {
+	for i, field := range msg.GetField() {
 		typeName := field.GetTypeName()
 		if typeName == "" {
 			continue
 		}
-		typeName = strings.TrimLeft(typeName, ".")
-		typeNameParts := strings.Split(typeName, ".")
-		trueName := typeNameParts[len(typeNameParts)-1]
-		pkgName := strings.TrimSuffix(typeName, "."+trueName)
-		var importPath string
-		ownPkg := f.GetPackage()
-		if len(pkgName) >= len(ownPkg) && pkgName[:len(ownPkg)] == ownPkg {
-			pkgName = ownPkg
-			pkg, ok := impexp.typeMap[ownPkg]
-			if !ok {
-				panic(fmt.Sprintf("failed to find own package %s in imports for file %s", ownPkg, fileName))
-			}
-			trueName = typeName[len(ownPkg)+1:]
-			parsedName := strings.ReplaceAll(trueName, ".", "__")
-			// Exclude local messages/enums from import
-			for _, msg2 := range f.GetMessageType() {
-				if msg2.GetName() == trueName {
-					continue FIELD_IMPORT_LOOP
-				}
-				for _, innerMsg := range msg2.GetNestedType() {
-					if msg2.GetName()+"."+innerMsg.GetName() == trueName {
-						continue FIELD_IMPORT_LOOP
-					}
-				}
-			}
-			details, ok := pkg[parsedName]
-			if !ok {
-				panic(fmt.Sprintf("failed to find type %s in exports for package %s in file %s", trueName, pkgName, fileName))
-			}
-			importPath = details.importPath
-		} else if pkgName == googleProtobufPrefix {
-			useGoogle = true
+		fieldUsesGoogle, err := generateImportForType(f, typeName, importMap, types)
+		if err != nil {
+			diags.add(childPath(path, messageFieldPath, int32(i)), "%v", err)
 			continue
-		} else {
-			pkg, ok := impexp.typeMap[pkgName]
-			if !ok {
-				panic(fmt.Sprintf("failed to find package %s in imports for file %s", pkgName, fileName))
-			}
-			details, ok := pkg[trueName]
-			if !ok {
-				panic(fmt.Sprintf("failed to find type %s in exports for package %s in file %s", trueName, pkgName, fileName))
-			}
-			importPath = fmt.Sprintf("%s/%s", details.npmPackage, details.importPath)
-		}
-		imports, _ := importMap[importPath]
-		uniqueImports := map[string]struct{}{}
-		for _, anImport := range imports {
-			uniqueImports[anImport] = struct{}{}
-		}
-		uniqueImports[fmt.Sprintf("%s as %s__%s", trueName, pkgName, trueName)] = struct{}{}
-		imports = []string{}
-		for anImport := range uniqueImports {
-			imports = append(imports, anImport)
 		}
-		for _, exp := range impexp.fileTypeMap[fileName] {
-			if exp == trueName {
-				// This is local, skip
-				continue FIELD_IMPORT_LOOP
-			}
+		useGoogle = fieldUsesGoogle || useGoogle
+	}
+	return
+}
+
+// generateImportForType adds the import required to reference the fully qualified type name from this file to the import map, if there is one
+func generateImportForType(f *descriptorpb.FileDescriptorProto, typeName string, importMap map[string][]string, types typeResolver) (useGoogle bool, err error) {
+	s, err := types.lookup(typeName)
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case s.kind == symbolWellKnown:
+		// Wrappers are generated as plain values, see wellknown.go
+		return !isWrapperType(typeName), nil
+	case s.file == f.GetName():
+		// This is local, skip
+		return false, nil
+	case s.details.importPath == "" && isGooglePackage(s.details.protoPackage):
+		return false, fmt.Errorf("type %s is defined in %s, which has no generated code to import, set the google_package option to the npm package it is generated in", typeName, s.file)
+	case s.details.importPath == "":
+		return false, fmt.Errorf("type %s is defined in %s, which has no generated code to import", typeName, s.file)
+	}
+	importPath := types.importSpecifier(s.details)
+	newImport := fmt.Sprintf("%s as %s", s.localName, s.importAlias())
+	for _, anImport := range importMap[importPath] {
+		if anImport == newImport {
+			return
 		}
-		importMap[importPath] = imports
 	}
+	importMap[importPath] = append(importMap[importPath], newImport)
 	return
 }
 
-func generateEnums(enums []*descriptorpb.EnumDescriptorProto, content *strings.Builder) {
-	for _, enum := range enums {
-		// TODO: get comment data somehow
-		comment := "An enum"
-		content.WriteString(fmt.Sprintf("/** %s */\nexport enum %s {\n", comment, enum.GetName()))
-		for _, value := range enum.GetValue() {
+// generateEnums writes all enums in the list, path is the location path of the list itself (e.g. [5] for top-level enums).
+// The proto prefix is the fully qualified proto name of the containing message or package, e.g. ".test.Outer".
+func generateEnums(enums []*descriptorpb.EnumDescriptorProto, content *strings.Builder, protoPrefix string, types typeResolver, comments commentSet, path []int32) {
+	for i, enum := range enums {
+		enumPath := childPath(path, int32(i))
+		content.WriteString(comments.generate(enumPath, ""))
+		content.WriteString(fmt.Sprintf("export enum %s {\n", types.symbols[protoPrefix+"."+enum.GetName()].localName))
+		for j, value := range enum.GetValue() {
 			// We don't bother stripping the trailing comma on the last enum element because Typescript doesn't care
-			// TODO: get comment data somehow
-			comment = "An enum value"
-			content.WriteString(fmt.Sprintf("	/** %s */\n	%s = %d,\n", comment, value.GetName(), value.GetNumber()))
+			content.WriteString(comments.generate(childPath(enumPath, enumValuePath, int32(j)), "	"))
+			content.WriteString(fmt.Sprintf("	%s = %d,\n", value.GetName(), value.GetNumber()))
 		}
 		content.WriteString("}\n\n")
 	}
 }
 
-func generateMessages(messages []*descriptorpb.DescriptorProto, content *strings.Builder, pkgName string, fileExports []string) {
-	for _, message := range messages {
-		// TODO: get comment data somehow
-		comment := "A message"
-		generateMessage(message, comment, message.GetName(), pkgName, content, fileExports)
-		for _, nestedType := range message.GetNestedType() {
-			if !nestedType.GetOptions().GetMapEntry() {
-				// TODO: get comment data somehow
-				comment = "A message"
-				name := fmt.Sprintf("%s__%s", message.GetName(), nestedType.GetName())
-				generateMessage(nestedType, comment, name, pkgName, content, fileExports)
-			}
-		}
+// generateNestedEnums writes the enums nested in all messages in the list, recursing through nested messages at any depth
+func generateNestedEnums(messages []*descriptorpb.DescriptorProto, content *strings.Builder, protoPrefix string, types typeResolver, comments commentSet, path []int32) {
+	for i, message := range messages {
+		messagePath := childPath(path, int32(i))
+		fullName := protoPrefix + "." + message.GetName()
+		generateEnums(message.GetEnumType(), content, fullName, types, comments, childPath(messagePath, messageEnumTypePath))
+		generateNestedEnums(message.GetNestedType(), content, fullName, types, comments, childPath(messagePath, messageNestedTypePath))
 	}
 }
 
-type mapTypeData struct {
-	toProtoJSON string
-	parse       string
-	keyIsString bool
+// generateMessages writes all messages in the list followed by their nested messages at any depth, path is the location path of the list itself (e.g. [4] for top-level messages).
+// Nested messages are named after all their containing messages joined by "__", e.g. Outer__Inner__Deep, see symbols.go.
+// The proto prefix is the fully qualified proto name of the containing message or package, e.g. ".test.Outer".
+func generateMessages(messages []*descriptorpb.DescriptorProto, content *strings.Builder, protoPrefix string, types typeResolver, parentFeatures resolvedFeatures, comments commentSet, diags *fileDiagnostics, path []int32) {
+	for i, message := range messages {
+		if message.GetOptions().GetMapEntry() {
+			continue
+		}
+		messagePath := childPath(path, int32(i))
+		features := parentFeatures.merge(message.GetOptions().GetFeatures())
+		fullName := protoPrefix + "." + message.GetName()
+		generateMessage(message, fullName, content, types, features, comments, diags, messagePath)
+		generateMessages(message.GetNestedType(), content, fullName, types, features, comments, diags, childPath(messagePath, messageNestedTypePath))
+	}
 }
 
-func generateMessage(msg *descriptorpb.DescriptorProto, comment, name, pkgName string, content *strings.Builder, fileExports []string) {
-	content.WriteString(fmt.Sprintf("/** %s */\nexport class %s extends Object implements tsjson.ProtoJSONCompatible {\n", comment, name))
-	mapTypes := map[string]mapTypeData{}
-	for _, nested := range msg.GetNestedType() {
-		if nested.GetOptions().GetMapEntry() {
-			mapToProtoJSON, mapParse := generateMarshallingStrings(nested.GetField()[1], msg, pkgName, fileExports, mapTypes, "val", `{"value":val}`)
-			mapTypes[fmt.Sprintf(".%s.%s.%s", pkgName, msg.GetName(), nested.GetName())] = mapTypeData{
-				toProtoJSON: mapToProtoJSON,
-				parse:       mapParse,
-				keyIsString: nested.GetField()[0].GetType() == descriptorpb.FieldDescriptorProto_TYPE_STRING,
-			}
+// generateMessage writes the class for a single message, features are the resolved features of the message itself.
+// Problems with individual fields are reported to diags and the rest of the message is still generated, so every problem in it is found in one pass.
+func generateMessage(msg *descriptorpb.DescriptorProto, fullName string, content *strings.Builder, types typeResolver, features resolvedFeatures, comments commentSet, diags *fileDiagnostics, path []int32) {
+	name := types.symbols[fullName].localName
+	content.WriteString(comments.generate(path, ""))
+	content.WriteString(fmt.Sprintf("export class %s extends Object implements tsjson.ProtoJSONCompatible {\n", name))
+	writtenOneofs := map[int32]bool{}
+	// Property names can only collide once escaped (see reserved.go), when a json_name option is set to the escaped name of another field
+	properties := map[string]string{}
+	declareProperty := func(property string, path []int32, description string) {
+		if other, ok := properties[property]; ok {
+			diags.add(path, "generated property %s collides with %s", property, other)
+			return
 		}
+		properties[property] = description
 	}
-	for _, field := range msg.GetField() {
-		if field.GetTypeName() == ".google.protobuf.NullValue" {
+	for i, field := range msg.GetField() {
+		if isOneofMember(field) {
+			// All members of a oneof share a single property, written where the first member appears
+			index := field.GetOneofIndex()
+			if writtenOneofs[index] {
+				continue
+			}
+			writtenOneofs[index] = true
+			oneofPath := childPath(path, messageOneofDeclPath, index)
+			oneofType, err := getOneofTypeName(msg, index, types, comments, path)
+			if err != nil {
+				diags.add(oneofPath, "%v", err)
+				continue
+			}
+			property := getOneofPropertyName(msg.GetOneofDecl()[index])
+			declareProperty(property, oneofPath, "oneof "+getElementName(diags.file, oneofPath))
+			content.WriteString(comments.generate(oneofPath, "	"))
+			content.WriteString(fmt.Sprintf("	public %s?:%s;\n", property, oneofType))
+			continue
+		}
+		fieldPath := childPath(path, messageFieldPath, int32(i))
+		tsType, err := getNativeTypeName(field, types)
+		if err != nil {
+			diags.add(fieldPath, "%v", err)
 			continue
 		}
-		tsType := getNativeTypeName(field, msg, pkgName, fileExports)
-		// FIXME: detect repeated/oneof?
-		// TODO: get comment data somehow
-		comment = "A field"
-		content.WriteString(fmt.Sprintf("	/** %s */\n	public %s?: %s;\n", comment, field.GetJsonName(), tsType))
+		property := getPropertyName(field)
+		declareProperty(property, fieldPath, "field "+getElementName(diags.file, fieldPath))
+		content.WriteString(comments.generate(fieldPath, "	"))
+		content.WriteString(fmt.Sprintf("	public %s?: %s;\n", objectKey(property), tsType))
 	}
+	generateDefaults(msg, types, content, diags, path)
 	protoJSONContent := &strings.Builder{}
 	protoJSONContent.WriteString(`		return {
 `)
@@ -353,18 +332,49 @@ func generateMessage(msg *descriptorpb.DescriptorProto, comment, name, pkgName s
 		let res = new %s();
 `, name))
 	// Build ToProtoJSON/Parser functions
-	for _, field := range msg.GetField() {
-		toProtoJSON, parse := generateMarshallingStrings(field, msg, pkgName, fileExports, mapTypes, "this."+field.GetJsonName(), "objData")
-		if toProtoJSON == "" && parse == "" {
-			if field.GetTypeName() == ".google.protobuf.NullValue" {
+	writtenOneofs = map[int32]bool{}
+	for i, field := range msg.GetField() {
+		if isOneofMember(field) {
+			index := field.GetOneofIndex()
+			if writtenOneofs[index] {
 				continue
 			}
-			panic(fmt.Sprintf("unhandled type: %s", field.GetTypeName()))
+			writtenOneofs[index] = true
+			toProtoJSON, parse, err := generateOneofMarshalling(msg, index, name, types)
+			if err != nil {
+				// Type resolution problems were already reported when the property was declared, anything else is new
+				if _, typeErr := getOneofTypeName(msg, index, types, nil, nil); typeErr == nil {
+					diags.add(childPath(path, messageOneofDeclPath, index), "%v", err)
+				}
+				continue
+			}
+			protoJSONContent.WriteString(toProtoJSON)
+			parseContent.WriteString(fmt.Sprintf(`		res.%s = %s;
+`, getOneofPropertyName(msg.GetOneofDecl()[index]), parse))
+			continue
+		}
+		inputName := memberAccess("this", getPropertyName(field))
+		fieldFeatures := getFieldFeatures(msg, field, features)
+		if field.GetLabel() != descriptorpb.FieldDescriptorProto_LABEL_REPEATED && !hasPresence(field, fieldFeatures) {
+			inputName = fmt.Sprintf("tsjson.ToProtoJSON.NonZero(%s)", inputName)
+		}
+		toProtoJSON, parse, err := generateMarshallingStrings(field, types, inputName, "objData")
+		if err != nil {
+			// Type resolution problems were already reported when the property was declared, anything else is new
+			if _, typeErr := getNativeTypeName(field, types); typeErr == nil {
+				diags.add(childPath(path, messageFieldPath, int32(i)), "%v", err)
+			}
+			continue
 		}
 		protoJSONContent.WriteString(fmt.Sprintf(`			%s: %s,
-`, field.GetJsonName(), toProtoJSON))
-		parseContent.WriteString(fmt.Sprintf(`		res.%s = await %s;
-`, field.GetJsonName(), parse))
+`, objectKey(field.GetJsonName()), toProtoJSON))
+		if isRequired(field, fieldFeatures) {
+			parseContent.WriteString(fmt.Sprintf(`		%s = tsjson.Parse.Required("%s", await %s);
+`, memberAccess("res", getPropertyName(field)), field.GetName(), parse))
+			continue
+		}
+		parseContent.WriteString(fmt.Sprintf(`		%s = await %s;
+`, memberAccess("res", getPropertyName(field)), parse))
 	}
 	protoJSONContent.WriteString(`		};`)
 	parseContent.WriteString(`		return res;`)
@@ -379,100 +389,12 @@ func generateMessage(msg *descriptorpb.DescriptorProto, comment, name, pkgName s
 	content.WriteString("}\n\n")
 }
 
-func generateMarshallingStrings(field *descriptorpb.FieldDescriptorProto, msg *descriptorpb.DescriptorProto, pkgName string, fileExports []string, mapTypes map[string]mapTypeData, inputName string, obj string) (toProtoJSON, parse string) {
-	label := field.GetLabel()
-	tsType := getNativeTypeName(field, msg, pkgName, fileExports)
-	nestedObjectPrefix := ""
-	if obj == `{"value":val}` {
-		nestedObjectPrefix = `async val => `
+// getNativeTypeName converts the type of a field to the typescript type of its property in the generated class
+func getNativeTypeName(field *descriptorpb.FieldDescriptorProto, types typeResolver) (string, error) {
+	if isNullValue(field) {
+		return "", errNullValue
 	}
-	switch field.GetType() {
-	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
-		switch label {
-		case descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL:
-			toProtoJSON = fmt.Sprintf(`tsjson.ToProtoJSON.Bool(%s)`, inputName)
-			parse = fmt.Sprintf(`tsjson.Parse.Bool(%s, "%s", "%s")`, obj, field.GetJsonName(), field.GetName())
-		case descriptorpb.FieldDescriptorProto_LABEL_REPEATED:
-			toProtoJSON = fmt.Sprintf(`tsjson.ToProtoJSON.Repeated(tsjson.ToProtoJSON.Bool, %s)`, field.GetJsonName())
-			parse = fmt.Sprintf(`tsjson.Parse.Repeated(%s, "%s", "%s", tsjson.PrimitiveParse.Bool())`, obj, field.GetJsonName(), field.GetName())
-		}
-	case descriptorpb.FieldDescriptorProto_TYPE_BYTES:
-		switch label {
-		case descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL:
-			toProtoJSON = fmt.Sprintf(`tsjson.ToProtoJSON.Bytes(%s)`, inputName)
-			parse = fmt.Sprintf(`tsjson.Parse.Bytes(%s, "%s", "%s")`, obj, field.GetJsonName(), field.GetName())
-		case descriptorpb.FieldDescriptorProto_LABEL_REPEATED:
-			toProtoJSON = fmt.Sprintf(`tsjson.ToProtoJSON.Repeated(tsjson.ToProtoJSON.Bytes, %s)`, inputName)
-			parse = fmt.Sprintf(`tsjson.Parse.Repeated(%s, "%s", "%s", tsjson.PrimitiveParse.Bytes())`, obj, field.GetJsonName(), field.GetName())
-		}
-	case descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, descriptorpb.FieldDescriptorProto_TYPE_FLOAT, descriptorpb.FieldDescriptorProto_TYPE_FIXED32, descriptorpb.FieldDescriptorProto_TYPE_INT32, descriptorpb.FieldDescriptorProto_TYPE_SFIXED32, descriptorpb.FieldDescriptorProto_TYPE_SINT32, descriptorpb.FieldDescriptorProto_TYPE_UINT32:
-		switch label {
-		case descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL:
-			toProtoJSON = fmt.Sprintf(`tsjson.ToProtoJSON.Number(%s)`, inputName)
-			parse = fmt.Sprintf(`tsjson.Parse.Number(%s, "%s", "%s")`, obj, field.GetJsonName(), field.GetName())
-		case descriptorpb.FieldDescriptorProto_LABEL_REPEATED:
-			toProtoJSON = fmt.Sprintf(`tsjson.ToProtoJSON.Repeated(tsjson.ToProtoJSON.Number, %s)`, inputName)
-			parse = fmt.Sprintf(`tsjson.Parse.Repeated(%s, "%s", "%s", tsjson.PrimitiveParse.Number())`, obj, field.GetJsonName(), field.GetName())
-		}
-	case descriptorpb.FieldDescriptorProto_TYPE_FIXED64, descriptorpb.FieldDescriptorProto_TYPE_SFIXED64, descriptorpb.FieldDescriptorProto_TYPE_UINT64, descriptorpb.FieldDescriptorProto_TYPE_SINT64, descriptorpb.FieldDescriptorProto_TYPE_INT64:
-		switch label {
-		case descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL:
-			toProtoJSON = fmt.Sprintf(`tsjson.ToProtoJSON.StringNumber(%s)`, inputName)
-			parse = fmt.Sprintf(`tsjson.Parse.Number(%s, "%s", "%s")`, obj, field.GetJsonName(), field.GetName())
-		case descriptorpb.FieldDescriptorProto_LABEL_REPEATED:
-			toProtoJSON = fmt.Sprintf(`tsjson.ToProtoJSON.Repeated(tsjson.ToProtoJSON.StringNumber, %s)`, inputName)
-			parse = fmt.Sprintf(`tsjson.Parse.Repeated(%s, "%s", "%s", tsjson.PrimitiveParse.Number())`, obj, field.GetJsonName(), field.GetName())
-		}
-	case descriptorpb.FieldDescriptorProto_TYPE_STRING:
-		switch label {
-		case descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL:
-			toProtoJSON = fmt.Sprintf(`tsjson.ToProtoJSON.String(%s)`, inputName)
-			parse = fmt.Sprintf(`tsjson.Parse.String(%s, "%s", "%s")`, obj, field.GetJsonName(), field.GetName())
-		case descriptorpb.FieldDescriptorProto_LABEL_REPEATED:
-			toProtoJSON = fmt.Sprintf(`tsjson.ToProtoJSON.Repeated(tsjson.ToProtoJSON.String, %s)`, inputName)
-			parse = fmt.Sprintf(`tsjson.Parse.Repeated(%s, "%s", "%s", tsjson.PrimitiveParse.String())`, obj, field.GetJsonName(), field.GetName())
-		}
-	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE:
-		mapStrings, isMap := mapTypes[field.GetTypeName()]
-		switch {
-		case isMap:
-			// TODO: parsers and marshallers for all the different map keys and values, basically nesting this entire switch/case again
-			toProtoJSON = fmt.Sprintf(`tsjson.ToProtoJSON.Map(val => %s, %s)`, mapStrings.toProtoJSON, inputName)
-			if mapStrings.keyIsString {
-				parse = fmt.Sprintf(`tsjson.Parse.Map(%s, "%s", "%s", async val => val, %s)`, obj, field.GetJsonName(), field.GetName(), mapStrings.parse)
-			} else {
-				parse = fmt.Sprintf(`tsjson.Parse.Map(%s, "%s", "%s", %s, async val => %s)`, obj, field.GetJsonName(), field.GetName(), "JSON.parse", mapStrings.parse)
-			}
-		case label == descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL:
-			toProtoJSON = fmt.Sprintf(`%s?.ToProtoJSON()`, inputName)
-			parse = fmt.Sprintf(`%stsjson.Parse.Message(%s, "%s", "%s", %s.Parse)`, nestedObjectPrefix, obj, field.GetJsonName(), field.GetName(), tsType)
-		case label == descriptorpb.FieldDescriptorProto_LABEL_REPEATED:
-			toProtoJSON = fmt.Sprintf(`tsjson.ToProtoJSON.Repeated(val => val.ToProtoJSON(), %s)`, inputName)
-			parse = fmt.Sprintf(`tsjson.Parse.Repeated(%s, "%s", "%s", %s.Parse)`, obj, field.GetJsonName(), field.GetName(), tsType[:len(tsType)-2])
-		}
-	case descriptorpb.FieldDescriptorProto_TYPE_ENUM:
-		if tsType == "google__protobuf__NullValue" {
-			return
-		}
-		// TODO: enums
-		switch label {
-		case descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL:
-			toProtoJSON = fmt.Sprintf(`tsjson.ToProtoJSON.Enum(%s, %s)`, tsType, inputName)
-			parse = fmt.Sprintf(`tsjson.Parse.Enum(%s, "%s", "%s", %s)`, obj, field.GetJsonName(), field.GetName(), tsType)
-		case descriptorpb.FieldDescriptorProto_LABEL_REPEATED:
-			trimmedType := tsType[:len(tsType)-2]
-			toProtoJSON = fmt.Sprintf(`tsjson.ToProtoJSON.Repeated(val => tsjson.ToProtoJSON.Enum(%s, val), %s)`, trimmedType, inputName)
-			parse = fmt.Sprintf(`tsjson.Parse.Repeated(%s, "%s", "%s", tsjson.PrimitiveParse.Enum(%s))`, obj, field.GetJsonName(), field.GetName(), trimmedType)
-		}
-	}
-	return
-}
-
-func generateComments(sourceCodeInfo *descriptorpb.SourceCodeInfo, content *strings.Builder) {
-
-}
-
-func getNativeTypeName(field *descriptorpb.FieldDescriptorProto, message *descriptorpb.DescriptorProto, pkgName string, fileExports []string) string {
+	field = unwrapField(field)
 	repeatedStr := ""
 	if field.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED {
 		repeatedStr = "[]"
@@ -491,50 +413,32 @@ func getNativeTypeName(field *descriptorpb.FieldDescriptorProto, message *descri
 		descriptorpb.FieldDescriptorProto_TYPE_SINT32,
 		descriptorpb.FieldDescriptorProto_TYPE_SINT64:
 		// Javascript only has one number format
-		return "number" + repeatedStr
+		return "number" + repeatedStr, nil
 	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
-		return "boolean" + repeatedStr
+		return "boolean" + repeatedStr, nil
 	case descriptorpb.FieldDescriptorProto_TYPE_STRING:
-		return "string" + repeatedStr
+		return "string" + repeatedStr, nil
 	case descriptorpb.FieldDescriptorProto_TYPE_BYTES:
-		return "Uint8Array" + repeatedStr
-	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE:
-		// TODO: this lookup is not efficient, but it'll do for now. building a map of known types by name as we go would be good
-		for _, nestedMessage := range message.GetNestedType() {
-			// FIXME: it is possible for this to misfire at least sometimes, though we'll see if it particularly matters
-			if nestedMessage.GetOptions().GetMapEntry() && strings.Contains(field.GetTypeName(), nestedMessage.GetName()) {
-				keyType := getNativeTypeName(nestedMessage.GetField()[0], nil, pkgName, fileExports)
-				valType := getNativeTypeName(nestedMessage.GetField()[1], nil, pkgName, fileExports)
-				return fmt.Sprintf("ReadonlyMap<%s, %s | null>", keyType, valType)
-			}
+		return "Uint8Array" + repeatedStr, nil
+	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_TYPE_GROUP, descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		s, err := types.lookup(field.GetTypeName())
+		if err != nil {
+			return "", err
 		}
-		fieldTypeName := strings.TrimLeft(field.GetTypeName(), ".")
-		if len(fieldTypeName) >= len(googleProtobufPrefix) && fieldTypeName[:len(googleProtobufPrefix)] == googleProtobufPrefix {
-			// This is a google well-known type
-			return fieldTypeName + repeatedStr
-		}
-		// Not a map, not a google type
-		fallthrough
-	case descriptorpb.FieldDescriptorProto_TYPE_ENUM:
-		typeName := field.GetTypeName()
-		matches := packageReplacement.FindStringSubmatch(typeName)
-		if len(matches) != 3 {
-			panic(fmt.Errorf("type name did not match any valid pattern: %s, found %d instead of 3: %s", typeName, len(matches), matches))
-		}
-		pkgSection := fmt.Sprintf("%s__", matches[1])
-		typeSection := strings.ReplaceAll(matches[2], ".", "__")
-		fullTypeSection := typeSection + repeatedStr
-		for _, exp := range fileExports {
-			if exp == typeSection {
-				return fullTypeSection
+		if s.kind == symbolMapEntry {
+			keyType, err := getNativeTypeName(s.mapEntry.GetField()[0], types)
+			if err != nil {
+				return "", err
 			}
+			valType, err := getNativeTypeName(s.mapEntry.GetField()[1], types)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("ReadonlyMap<%s, %s | null>", keyType, valType), nil
 		}
-		return fmt.Sprintf("%s%s", pkgSection, fullTypeSection)
+		typeName, err := types.typeName(field.GetTypeName())
+		return typeName + repeatedStr, err
 	default:
-		panic(fmt.Errorf("unknown field type: %s", field))
+		return "", fmt.Errorf("unknown field type %s", field.GetType())
 	}
 }
-
-func getProtoJSONTypeName(field *descriptorpb.FieldDescriptorProto, nestedTypes []*descriptorpb.DescriptorProto) string {
-	panic("not implemented")
-}
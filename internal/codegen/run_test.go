@@ -0,0 +1,128 @@
+package codegen
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/LLKennedy/protoc-gen-tsjson/tsjsonpb"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// Generator tests describe their proto files as FileDescriptorProtos in text format, exactly as protoc would send them, and check snippets of the generated typescript or the diagnostics reported.
+
+// testDependencies are available to every test file, as they would be to any file importing them
+var testDependencies = []protoreflect.FileDescriptor{
+	descriptorpb.File_google_protobuf_descriptor_proto,
+	tsjsonpb.File_tsjson_proto,
+	anypb.File_google_protobuf_any_proto,
+	durationpb.File_google_protobuf_duration_proto,
+	emptypb.File_google_protobuf_empty_proto,
+	fieldmaskpb.File_google_protobuf_field_mask_proto,
+	structpb.File_google_protobuf_struct_proto,
+	timestamppb.File_google_protobuf_timestamp_proto,
+	wrapperspb.File_google_protobuf_wrappers_proto,
+}
+
+// proto3File is a text format proto3 file named test.proto in package test, with the tsjson options set, body holds its messages, enums and services
+func proto3File(body string) string {
+	return `name: "test.proto" package: "test" syntax: "proto3"
+options { [tsjson.npm_package]: "@acme/test" [tsjson.import_path]: "test" }
+` + body
+}
+
+// generate runs the plugin with the parameter on the text format files, returning the content of each generated file by name, or the error the plugin reported
+func generate(t *testing.T, parameter string, files ...string) (map[string]string, error) {
+	t.Helper()
+	request := &pluginpb.CodeGeneratorRequest{Parameter: proto.String(parameter)}
+	for _, dependency := range testDependencies {
+		request.ProtoFile = append(request.ProtoFile, protodesc.ToFileDescriptorProto(dependency))
+	}
+	for _, text := range files {
+		file := &descriptorpb.FileDescriptorProto{}
+		if err := prototext.Unmarshal([]byte(text), file); err != nil {
+			t.Fatalf("invalid test file: %v", err)
+		}
+		setJSONNames(file.GetMessageType())
+		request.ProtoFile = append(request.ProtoFile, file)
+		request.FileToGenerate = append(request.FileToGenerate, file.GetName())
+	}
+	response := Run(request)
+	if response.Error != nil {
+		return nil, errors.New(response.GetError())
+	}
+	generated := map[string]string{}
+	for _, file := range response.GetFile() {
+		generated[file.GetName()] = file.GetContent()
+	}
+	return generated, nil
+}
+
+// setJSONNames fills in the json_name protoc sets on every field
+func setJSONNames(messages []*descriptorpb.DescriptorProto) {
+	for _, msg := range messages {
+		for _, field := range msg.GetField() {
+			if field.JsonName == nil {
+				field.JsonName = proto.String(jsonName(field.GetName()))
+			}
+		}
+		setJSONNames(msg.GetNestedType())
+	}
+}
+
+// generateFile generates the files, failing the test unless the named file is generated without errors
+func generateFile(t *testing.T, parameter, name string, files ...string) string {
+	t.Helper()
+	generated, err := generate(t, parameter, files...)
+	if err != nil {
+		t.Fatalf("generation failed: %v", err)
+	}
+	content, ok := generated[name]
+	if !ok {
+		t.Fatalf("%s was not generated", name)
+	}
+	return content
+}
+
+// assertContains fails the test for each snippet missing from the generated content
+func assertContains(t *testing.T, content string, snippets ...string) {
+	t.Helper()
+	for _, snippet := range snippets {
+		if !strings.Contains(content, snippet) {
+			t.Errorf("generated content is missing %q, generated:\n%s", snippet, content)
+		}
+	}
+}
+
+// assertNotContains fails the test for each snippet found in the generated content
+func assertNotContains(t *testing.T, content string, snippets ...string) {
+	t.Helper()
+	for _, snippet := range snippets {
+		if strings.Contains(content, snippet) {
+			t.Errorf("generated content unexpectedly contains %q, generated:\n%s", snippet, content)
+		}
+	}
+}
+
+// assertDiagnostics fails the test unless generation failed with exactly the diagnostics, one per line
+func assertDiagnostics(t *testing.T, err error, diagnostics ...string) {
+	t.Helper()
+	if err == nil {
+		t.Fatalf("generation succeeded, want diagnostics %q", diagnostics)
+	}
+	if got, want := err.Error(), strings.Join(diagnostics, "\n"); got != want {
+		t.Errorf("diagnostics = %q, want %q", strings.Split(got, "\n"), diagnostics)
+	}
+}
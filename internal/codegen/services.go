@@ -0,0 +1,137 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Services are generated as client classes with one method per RPC, sending requests to the httpgrpc path for the method (e.g. "/test.Example/DoStuff").
+// Unary methods go through an injected tsjson.UnaryTransport, streaming methods through a tsjson.StreamTransport (usually a websocket).
+// Server streams are exposed as AsyncIterable<Response>, client streams accept any tsjson.Streamable<Request>, including a tsjson.MessageWriter.
+
+// generateImportsForService adds the imports for the input and output types of every method in the service to the import map, path is the location path of the service
+func generateImportsForService(f *descriptorpb.FileDescriptorProto, service *descriptorpb.ServiceDescriptorProto, importMap map[string][]string, types typeResolver, diags *fileDiagnostics, path []int32) (useGoogle bool) {
+	for i, method := range service.GetMethod() {
+		for _, typeName := range []string{method.GetInputType(), method.GetOutputType()} {
+			typeUsesGoogle, err := generateImportForType(f, typeName, importMap, types)
+			if err != nil {
+				diags.add(childPath(path, serviceMethodPath, int32(i)), "%v", err)
+				continue
+			}
+			useGoogle = typeUsesGoogle || useGoogle
+		}
+	}
+	return
+}
+
+// generateServices writes a client class for each service, path is the location path of the list itself (e.g. [6] for all services in a file)
+func generateServices(services []*descriptorpb.ServiceDescriptorProto, content *strings.Builder, pkgName string, types typeResolver, comments commentSet, diags *fileDiagnostics, path []int32) {
+	for i, service := range services {
+		servicePath := childPath(path, int32(i))
+		transportType := getTransportType(service)
+		content.WriteString(comments.generate(servicePath, ""))
+		content.WriteString(fmt.Sprintf(`export class %s {
+	private readonly transport: %s;
+	constructor(transport: %s) {
+		this.transport = transport;
+	}
+`, getClientName(service), transportType, transportType))
+		methods := map[string]string{}
+		for j, method := range service.GetMethod() {
+			locationPath := childPath(servicePath, serviceMethodPath, int32(j))
+			inputType, inputErr := types.typeName(method.GetInputType())
+			outputType, outputErr := types.typeName(method.GetOutputType())
+			if inputErr != nil || outputErr != nil {
+				for _, err := range []error{inputErr, outputErr} {
+					if err != nil {
+						diags.add(locationPath, "%v", err)
+					}
+				}
+				continue
+			}
+			// Wrappers are generated as bare values (see wellknown.go), which have no Parse or ToProtoJSON for the client to call
+			if wrapper := firstWrapperType(method.GetInputType(), method.GetOutputType()); wrapper != "" {
+				diags.add(locationPath, "wrapper type %s can't be used as a method input or output, use a message containing it instead", strings.TrimPrefix(wrapper, "."))
+				continue
+			}
+			methodPath := getMethodPath(pkgName, service, method)
+			methodName := escapeMethodName(method.GetName())
+			if other, ok := methods[methodName]; ok {
+				// Only possible once escaped, e.g. methods named delete and delete_
+				diags.add(locationPath, "generated method %s collides with method %s", methodName, other)
+				continue
+			}
+			methods[methodName] = method.GetName()
+			content.WriteString(comments.generate(locationPath, "	"))
+			switch {
+			case method.GetClientStreaming() && method.GetServerStreaming():
+				content.WriteString(fmt.Sprintf(`	public %s(reqs: tsjson.Streamable<%s>): AsyncIterable<%s> {
+		return tsjson.Stream.Bidi(this.transport, "%s", reqs, %s.Parse);
+	}
+`, methodName, inputType, outputType, methodPath, outputType))
+			case method.GetClientStreaming():
+				content.WriteString(fmt.Sprintf(`	public async %s(reqs: tsjson.Streamable<%s>): Promise<%s> {
+		return tsjson.Stream.Client(this.transport, "%s", reqs, %s.Parse);
+	}
+`, methodName, inputType, outputType, methodPath, outputType))
+			case method.GetServerStreaming():
+				content.WriteString(fmt.Sprintf(`	public %s(req: %s): AsyncIterable<%s> {
+		return tsjson.Stream.Server(this.transport, "%s", req, %s.Parse);
+	}
+`, methodName, inputType, outputType, methodPath, outputType))
+			default:
+				content.WriteString(fmt.Sprintf(`	public async %s(req: %s): Promise<%s> {
+		return %s.Parse(await this.transport.Post("%s", req.ToProtoJSON()));
+	}
+`, methodName, inputType, outputType, outputType, methodPath))
+			}
+		}
+		content.WriteString("}\n\n")
+	}
+}
+
+// firstWrapperType returns the first of the type names which is a wrapper well-known type, or an empty string if none are
+func firstWrapperType(typeNames ...string) string {
+	for _, typeName := range typeNames {
+		if isWrapperType(typeName) {
+			return typeName
+		}
+	}
+	return ""
+}
+
+// getClientName is the name of the client class generated for a service, mangled like a type name so it can't collide with an import alias (see naming.go)
+func getClientName(service *descriptorpb.ServiceDescriptorProto) string {
+	return mangleName(service.GetName()) + "Client"
+}
+
+// getTransportType determines which transports a client needs based on the kinds of methods in the service
+func getTransportType(service *descriptorpb.ServiceDescriptorProto) string {
+	unary, streaming := false, false
+	for _, method := range service.GetMethod() {
+		if method.GetClientStreaming() || method.GetServerStreaming() {
+			streaming = true
+		} else {
+			unary = true
+		}
+	}
+	switch {
+	case unary && streaming:
+		return "tsjson.UnaryTransport & tsjson.StreamTransport"
+	case streaming:
+		return "tsjson.StreamTransport"
+	default:
+		return "tsjson.UnaryTransport"
+	}
+}
+
+// getMethodPath builds the httpgrpc path for a method, which matches the gRPC method name: /<package>.<Service>/<Method>
+func getMethodPath(pkgName string, service *descriptorpb.ServiceDescriptorProto, method *descriptorpb.MethodDescriptorProto) string {
+	serviceName := service.GetName()
+	if pkgName != "" {
+		serviceName = pkgName + "." + serviceName
+	}
+	return fmt.Sprintf("/%s/%s", serviceName, method.GetName())
+}
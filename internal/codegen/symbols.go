@@ -0,0 +1,223 @@
+package codegen
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/LLKennedy/protoc-gen-tsjson/tsjsonpb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Every message and enum in a request, from every file including dependencies, is recorded once in a symbol table.
+// Symbols are keyed by their fully qualified proto name exactly as descriptors refer to them (e.g. ".test.RootMessage.Inner"), so all type references resolve the same way and can't match the wrong type by prefix.
+
+type symbolKind int
+
+const (
+	symbolMessage symbolKind = iota
+	symbolEnum
+	// symbolMapEntry is the message protoc creates for each map field, it is never generated as a class of its own
+	symbolMapEntry
+	// symbolWellKnown is a google.protobuf type provided by the runtime rather than generated, see wellknown.go
+	symbolWellKnown
+)
+
+// symbol is a single message or enum
+type symbol struct {
+	fullName string
+	kind     symbolKind
+	// file is the name of the proto file defining the type
+	file string
+	// localName is the identifier the type is declared as in its own generated file, e.g. RootMessage__Inner
+	localName string
+	// details are where the generated file defining the type is imported from
+	details exportDetails
+	// closed is set for enums which reject unknown values
+	closed bool
+	// mapEntry holds the key and value fields of map entries
+	mapEntry *descriptorpb.DescriptorProto
+}
+
+// importAlias is the identifier the type is imported as in files other than its own, e.g. test___RootMessage__Inner
+func (s *symbol) importAlias() string {
+	return mangleAlias(s.details.protoPackage, s.localName)
+}
+
+type exportDetails struct {
+	npmPackage   string
+	importPath   string
+	protoPackage string
+}
+
+// getExportDetails reads where the generated code for a file is imported from out of its tsjson options, unless an M or P parameter maps the file elsewhere.
+// Files in google packages can't normally be given options, so unless they have their own they are generated into opts.googlePackage at their default import path.
+// The import_path option is only used by the default paths=import mode, the other modes always use the default import path instead.
+func getExportDetails(f *descriptorpb.FileDescriptorProto, opts options) exportDetails {
+	npmPackage, _ := proto.GetExtension(f.GetOptions(), tsjsonpb.E_NpmPackage).(string)
+	importPath, _ := proto.GetExtension(f.GetOptions(), tsjsonpb.E_ImportPath).(string)
+	protoPath := defaultImportPath(f.GetName(), f.GetPackage(), opts.paths)
+	if opts.paths != pathsImport {
+		importPath = protoPath
+	}
+	if mapping, ok := opts.fileMappings[f.GetName()]; ok {
+		npmPackage, importPath = mapping.npmPackage, mapping.importPath
+	} else if mapping, ok := opts.packageMappings[f.GetPackage()]; ok {
+		npmPackage, importPath = mapping.npmPackage, path.Join(mapping.importPath, protoPath)
+	} else if isGooglePackage(f.GetPackage()) && npmPackage == "" && opts.googlePackage != "" {
+		npmPackage = opts.googlePackage
+		if importPath == "" || opts.paths != pathsImport {
+			importPath = path.Join(opts.googleImportRoot, protoPath)
+		}
+	}
+	return exportDetails{
+		npmPackage:   npmPackage,
+		importPath:   importPath,
+		protoPackage: f.GetPackage(),
+	}
+}
+
+// symbolTable maps fully qualified proto names to their symbols
+type symbolTable map[string]*symbol
+
+// buildSymbolTable records every type declared in the files, reporting any file which can't be read to diags
+func buildSymbolTable(files []*descriptorpb.FileDescriptorProto, opts options, diags *diagnostics) symbolTable {
+	symbols := symbolTable{}
+	for _, file := range files {
+		features, err := getFileFeatures(file)
+		if err != nil {
+			diags.forFile(file).add(nil, "%v", err)
+			continue
+		}
+		base := symbol{
+			file:    file.GetName(),
+			details: getExportDetails(file, opts),
+		}
+		protoPrefix := ""
+		if file.GetPackage() != "" {
+			protoPrefix = "." + file.GetPackage()
+		}
+		for _, enum := range file.GetEnumType() {
+			symbols.addEnum(enum, base, protoPrefix, "", features)
+		}
+		for _, msg := range file.GetMessageType() {
+			symbols.addMessage(msg, base, protoPrefix, "", features)
+		}
+	}
+	return symbols
+}
+
+// addMessage records a message and all types nested inside it, at any depth, with local names mangled as described in naming.go.
+// The proto prefix is the fully qualified name of the containing message or package, the name prefix is the local name of the containing message followed by "__", or empty for top-level messages.
+func (t symbolTable) addMessage(msg *descriptorpb.DescriptorProto, base symbol, protoPrefix, namePrefix string, parentFeatures resolvedFeatures) {
+	features := parentFeatures.merge(msg.GetOptions().GetFeatures())
+	s := base
+	s.fullName = protoPrefix + "." + msg.GetName()
+	// Nested types are named after the mangled name, not the escaped one, so they can't end up with "___" in their names
+	mangled := namePrefix + mangleName(msg.GetName())
+	s.localName = escapeTypeName(mangled)
+	s.kind = symbolMessage
+	if msg.GetOptions().GetMapEntry() {
+		s.kind = symbolMapEntry
+		s.mapEntry = msg
+	}
+	t.add(s)
+	for _, enum := range msg.GetEnumType() {
+		t.addEnum(enum, base, s.fullName, mangled+nestedSeparator, features)
+	}
+	for _, nested := range msg.GetNestedType() {
+		t.addMessage(nested, base, s.fullName, mangled+nestedSeparator, features)
+	}
+}
+
+// addEnum records an enum, the prefixes are the same as for addMessage
+func (t symbolTable) addEnum(enum *descriptorpb.EnumDescriptorProto, base symbol, protoPrefix, namePrefix string, parentFeatures resolvedFeatures) {
+	s := base
+	s.fullName = protoPrefix + "." + enum.GetName()
+	s.localName = escapeTypeName(namePrefix + mangleName(enum.GetName()))
+	s.kind = symbolEnum
+	s.closed = parentFeatures.merge(enum.GetOptions().GetFeatures()).enumType == descriptorpb.FeatureSet_CLOSED
+	t.add(s)
+}
+
+func (t symbolTable) add(s symbol) {
+	if s.details.protoPackage == googleProtobufPrefix && isRuntimeType(s.fullName) {
+		s.kind = symbolWellKnown
+	}
+	t[s.fullName] = &s
+}
+
+// getFileLocation is where a generated file is written and imported from, files with no import path of their own are at their default import path
+func getFileLocation(f *descriptorpb.FileDescriptorProto, opts options) exportDetails {
+	location := getExportDetails(f, opts)
+	if location.importPath == "" {
+		location.importPath = defaultImportPath(f.GetName(), f.GetPackage(), opts.paths)
+	}
+	return location
+}
+
+// typeResolver resolves proto type names for code generated in a single file
+type typeResolver struct {
+	symbols symbolTable
+	// file is the name of the proto file being generated
+	file string
+	// location is where the file being generated is imported from, imports of other generated files are relative to it
+	location exportDetails
+}
+
+// lookup finds the symbol for a fully qualified type name, e.g. ".test.RootMessage"
+func (r typeResolver) lookup(typeName string) (*symbol, error) {
+	s, ok := r.symbols[typeName]
+	if !ok {
+		return nil, fmt.Errorf("unknown type %s", typeName)
+	}
+	if s.details.protoPackage == googleProtobufPrefix && s.kind != symbolWellKnown {
+		// google.protobuf files are never generated, so only the types the runtime provides exist
+		return nil, fmt.Errorf("type %s is not supported, the runtime only provides the well-known types", strings.TrimPrefix(typeName, "."))
+	}
+	return s, nil
+}
+
+// typeName converts a fully qualified type name to the typescript name it is declared or imported as in this file
+func (r typeResolver) typeName(typeName string) (string, error) {
+	s, err := r.lookup(typeName)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case s.kind == symbolWellKnown:
+		return strings.TrimPrefix(s.fullName, "."), nil
+	case s.file == r.file:
+		return s.localName, nil
+	default:
+		return s.importAlias(), nil
+	}
+}
+
+// importSpecifier is the module specifier to import another generated file by.
+// Files in the same npm package import each other by relative path, so packages work before they are published, and anything else is imported from its package.
+func (r typeResolver) importSpecifier(other exportDetails) string {
+	if other.npmPackage != r.location.npmPackage {
+		return other.npmPackage + "/" + other.importPath
+	}
+	return relativeImport(r.location.importPath, other.importPath)
+}
+
+// relativeImport is the relative module specifier from one path within an npm package to another, both without extensions
+func relativeImport(from, to string) string {
+	fromDir := strings.Split(path.Dir(from), "/")
+	if fromDir[0] == "." {
+		fromDir = nil
+	}
+	toParts := strings.Split(to, "/")
+	common := 0
+	for common < len(fromDir) && common < len(toParts)-1 && fromDir[common] == toParts[common] {
+		common++
+	}
+	specifier := strings.Repeat("../", len(fromDir)-common) + strings.Join(toParts[common:], "/")
+	if !strings.HasPrefix(specifier, "../") {
+		specifier = "./" + specifier
+	}
+	return specifier
+}
@@ -0,0 +1,199 @@
+package codegen
+
+import "testing"
+
+// otherPackageFile is a text format proto3 file named b/example.proto in package b, in the same npm package as proto3File, body holds its messages and enums
+func otherPackageFile(body string) string {
+	return `name: "b/example.proto" package: "b" syntax: "proto3"
+options { [tsjson.npm_package]: "@acme/test" [tsjson.import_path]: "b/example" }
+` + body
+}
+
+// Types are resolved by their fully qualified name, so messages sharing a short name in different packages stay distinct
+func TestTypesResolveByFullyQualifiedName(t *testing.T) {
+	content := generateFile(t, "", "test.ts", otherPackageFile(`message_type { name: "Example" }`), proto3File(`dependency: "b/example.proto"
+message_type {
+	name: "Example"
+	field { name: "local" number: 1 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".test.Example" }
+	field { name: "other" number: 2 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".b.Example" }
+}`))
+	assertContains(t, content,
+		"\tExample as b___Example\n} from \"./b/example\";",
+		"public local?: Example;",
+		"public other?: b___Example;",
+		`res.local = await tsjson.Parse.Message(objData, "local", "local", Example.Parse);`,
+		`res.other = await tsjson.Parse.Message(objData, "other", "other", b___Example.Parse);`,
+	)
+}
+
+func TestUnknownTypes(t *testing.T) {
+	_, err := generate(t, "", proto3File(`
+message_type {
+	name: "Example"
+	field { name: "missing" number: 1 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".test.Missing" }
+}`))
+	assertDiagnostics(t, err, "test.proto: test.Example.missing: unknown type .test.Missing")
+}
+
+// moneyFile is google/type/money.proto, which like every google file has no tsjson options
+const moneyFile = `name: "google/type/money.proto" package: "google.type" syntax: "proto3"
+message_type { name: "Money" field { name: "units" number: 2 label: LABEL_OPTIONAL type: TYPE_INT64 } }`
+
+func TestGooglePackages(t *testing.T) {
+	file := proto3File(`dependency: "google/type/money.proto"
+message_type {
+	name: "Example"
+	field { name: "price" number: 1 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".google.type.Money" }
+}`)
+	generated, err := generate(t, "google_package=@acme/googleapis,google_import_root=gen", moneyFile, file)
+	if err != nil {
+		t.Fatalf("generation failed: %v", err)
+	}
+	if _, ok := generated["gen/google/type/money.ts"]; !ok {
+		t.Errorf("gen/google/type/money.ts was not generated")
+	}
+	assertContains(t, generated["test.ts"],
+		"\tMoney as google__type___Money\n} from \"@acme/googleapis/gen/google/type/money\";",
+		"public price?: google__type___Money;",
+	)
+	_, err = generate(t, "", moneyFile, file)
+	assertDiagnostics(t, err, "test.proto: test.Example.price: type .google.type.Money is defined in google/type/money.proto, which has no generated code to import, set the google_package option to the npm package it is generated in")
+}
+
+func TestUnsupportedGoogleProtobufTypes(t *testing.T) {
+	_, err := generate(t, "", proto3File(`dependency: "google/protobuf/descriptor.proto"
+message_type {
+	name: "Example"
+	field { name: "file" number: 1 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".google.protobuf.FileDescriptorProto" }
+}`))
+	assertDiagnostics(t, err, "test.proto: test.Example.file: type google.protobuf.FileDescriptorProto is not supported, the runtime only provides the well-known types")
+}
+
+// Nested types from other files are imported by their mangled name within the file declaring them, aliased with their package, wherever they are used
+func TestNestedTypeImports(t *testing.T) {
+	otherPackage := `name: "b/example.proto" package: "b" syntax: "proto2"
+options { [tsjson.npm_package]: "@acme/test" [tsjson.import_path]: "b/example" }
+message_type {
+	name: "Outer"
+	nested_type { name: "Inner" nested_type { name: "Deepest" } }
+	enum_type { name: "Kind" value { name: "KIND_A" number: 1 } value { name: "KIND_B" number: 2 } }
+}`
+	samePackage := `name: "other.proto" package: "test" syntax: "proto2"
+options { [tsjson.npm_package]: "@acme/test" [tsjson.import_path]: "sub/other" }
+message_type {
+	name: "Holder"
+	nested_type { name: "Nested" }
+	enum_type { name: "Mode" value { name: "MODE_A" number: 1 } }
+}`
+	otherNPMPackage := `name: "external.proto" package: "ext" syntax: "proto2"
+options { [tsjson.npm_package]: "@acme/external" [tsjson.import_path]: "gen/external" }
+message_type { name: "Outer" nested_type { name: "Inner" } }`
+	content := generateFile(t, "", "test.ts", otherPackage, samePackage, otherNPMPackage, proto2File(`dependency: "b/example.proto" dependency: "other.proto" dependency: "external.proto"
+message_type {
+	name: "Example"
+	field { name: "inner" number: 1 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".b.Outer.Inner" }
+	field { name: "nested" number: 2 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".test.Holder.Nested" }
+	field { name: "kinds" number: 3 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".test.Example.KindsEntry" }
+	field { name: "mode" number: 4 label: LABEL_OPTIONAL type: TYPE_ENUM type_name: ".test.Holder.Mode" oneof_index: 0 }
+	field { name: "deepest" number: 5 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".b.Outer.Inner.Deepest" oneof_index: 0 }
+	field { name: "kind" number: 6 label: LABEL_OPTIONAL type: TYPE_ENUM type_name: ".b.Outer.Kind" default_value: "KIND_B" }
+	field { name: "external" number: 7 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".ext.Outer.Inner" }
+	nested_type {
+		name: "KindsEntry"
+		field { name: "key" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING }
+		field { name: "value" number: 2 label: LABEL_OPTIONAL type: TYPE_ENUM type_name: ".b.Outer.Kind" }
+		options { map_entry: true }
+	}
+	oneof_decl { name: "choice" }
+}
+service {
+	name: "Svc"
+	method { name: "Do" input_type: ".b.Outer.Inner" output_type: ".test.Holder.Nested" }
+}`))
+	assertContains(t, content,
+		// Imports
+		"import { \n\tOuter__Inner as b___Outer__Inner,\n\tOuter__Inner__Deepest as b___Outer__Inner__Deepest,\n\tOuter__Kind as b___Outer__Kind\n} from \"./b/example\";",
+		"import { \n\tHolder__Mode as test___Holder__Mode,\n\tHolder__Nested as test___Holder__Nested\n} from \"./sub/other\";",
+		"import { \n\tOuter__Inner as ext___Outer__Inner\n} from \"@acme/external/gen/external\";",
+		// Singular
+		"public inner?: b___Outer__Inner;",
+		`res.inner = await tsjson.Parse.Message(objData, "inner", "inner", b___Outer__Inner.Parse);`,
+		"public external?: ext___Outer__Inner;",
+		// Repeated
+		"public nested?: test___Holder__Nested[];",
+		`res.nested = await tsjson.Parse.Repeated(objData, "nested", "nested", tsjson.PrimitiveParse.Message(test___Holder__Nested.Parse));`,
+		// Map value
+		"public kinds?: ReadonlyMap<string, b___Outer__Kind | null>;",
+		"kinds: tsjson.ToProtoJSON.Map(val => tsjson.ToProtoJSON.Enum(b___Outer__Kind, val), this.kinds),",
+		`res.kinds = await tsjson.Parse.Map(objData, "kinds", "kinds", tsjson.MapKeys.ParseString, tsjson.PrimitiveParse.Enum(b___Outer__Kind, false));`,
+		// Oneof
+		`public choice?: { case: "mode", value: test___Holder__Mode } | { case: "deepest", value: b___Outer__Inner__Deepest };`,
+		`mode: this.choice?.case === "mode" ? tsjson.ToProtoJSON.Enum(test___Holder__Mode, this.choice.value) : undefined,`,
+		`{ case: "deepest", value: await tsjson.Parse.Message(objData, "deepest", "deepest", b___Outer__Inner__Deepest.Parse) },`,
+		// Proto2 default
+		"\t\tkind: b___Outer__Kind.KIND_B as b___Outer__Kind,\n",
+		// Service method
+		"public async Do(req: b___Outer__Inner): Promise<test___Holder__Nested> {",
+		`return test___Holder__Nested.Parse(await this.transport.Post("/test.Svc/Do", req.ToProtoJSON()));`,
+	)
+}
+
+// Files in the same npm package are imported relative to the generated file, whatever their proto package, and files in other npm packages from the package itself
+func TestImportSpecifiers(t *testing.T) {
+	file := func(name, protoPackage, npmPackage, importPath, message string) string {
+		return `name: "` + name + `" package: "` + protoPackage + `" syntax: "proto3"
+options { [tsjson.npm_package]: "` + npmPackage + `" [tsjson.import_path]: "` + importPath + `" }
+message_type { name: "` + message + `" }`
+	}
+	content := generateFile(t, "", "a/b/main.ts",
+		file("sibling.proto", "test", "@acme/test", "a/b/sibling", "Sibling"),
+		file("child.proto", "test", "@acme/test", "a/b/deep/child", "Child"),
+		file("cousin.proto", "cousin", "@acme/test", "a/c/cousin", "Cousin"),
+		file("top.proto", "top", "@acme/test", "top", "Top"),
+		file("external.proto", "test", "@acme/external", "a/b/external", "External"),
+		`name: "main.proto" package: "test" syntax: "proto3"
+options { [tsjson.npm_package]: "@acme/test" [tsjson.import_path]: "a/b/main" }
+dependency: ["sibling.proto", "child.proto", "cousin.proto", "top.proto", "external.proto"]
+message_type {
+	name: "Example"
+	field { name: "sibling" number: 1 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".test.Sibling" }
+	field { name: "child" number: 2 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".test.Child" }
+	field { name: "cousin" number: 3 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".cousin.Cousin" }
+	field { name: "top" number: 4 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".top.Top" }
+	field { name: "external" number: 5 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".test.External" }
+}`)
+	assertContains(t, content,
+		"} from \"./sibling\";",
+		"} from \"./deep/child\";",
+		"} from \"../c/cousin\";",
+		"} from \"../../top\";",
+		// Sharing a proto package doesn't make the external file local
+		"} from \"@acme/external/a/b/external\";",
+	)
+}
+
+func TestRelativeImport(t *testing.T) {
+	tests := []struct {
+		from string
+		to   string
+		want string
+	}{
+		{from: "root", to: "other", want: "./other"},
+		{from: "root", to: "test/other", want: "./test/other"},
+		{from: "test/root", to: "test/other", want: "./other"},
+		{from: "test/root", to: "other", want: "../other"},
+		{from: "test/root", to: "sub/other", want: "../sub/other"},
+		{from: "a/b/root", to: "a/other", want: "../other"},
+		{from: "a/b/root", to: "a/c/other", want: "../c/other"},
+		{from: "a/root", to: "a/b/c/other", want: "./b/c/other"},
+		{from: "a/root", to: "a", want: "../a"},
+		{from: "acme/index", to: "acme/billing/invoice", want: "./billing/invoice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from+" to "+tt.to, func(t *testing.T) {
+			if got := relativeImport(tt.from, tt.to); got != tt.want {
+				t.Errorf("relativeImport(%q, %q) = %q, want %q", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
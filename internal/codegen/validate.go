@@ -0,0 +1,118 @@
+package codegen
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/LLKennedy/protoc-gen-tsjson/tsjsonpb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Every file in a request is validated before anything is generated, since a file with bad options breaks the imports of every file depending on it.
+// google.protobuf is exempt, it is provided by the runtime rather than imported from its own package.
+// Other google packages are only checked once the google_package option gives them somewhere to be generated, until then any use of their types is reported as it is imported instead.
+
+// Location path to the tsjson options of a file, see descriptor.proto and tsjson.proto
+const fileOptionsPath = 8
+
+var (
+	fileOptionsNpmPackagePath = []int32{fileOptionsPath, int32(tsjsonpb.E_NpmPackage.TypeDescriptor().Number())}
+	fileOptionsImportPathPath = []int32{fileOptionsPath, int32(tsjsonpb.E_ImportPath.TypeDescriptor().Number())}
+)
+
+// npmPackageName matches valid npm package names, optionally scoped, see https://docs.npmjs.com/cli/configuring-npm/package-json#name
+var npmPackageName = regexp.MustCompile(`^(@[a-z0-9~-][a-z0-9._~-]*/)?[a-z0-9~-][a-z0-9._~-]*$`)
+
+// maxNpmPackageLength is the longest package name npm accepts
+const maxNpmPackageLength = 214
+
+// isGooglePackage reports whether the proto package is one of google's, e.g. google.type
+func isGooglePackage(pkgName string) bool {
+	return strings.HasPrefix(pkgName, googlePrefix)
+}
+
+// validateFiles checks the tsjson options of every file, reporting all problems to diags
+func validateFiles(files []*descriptorpb.FileDescriptorProto, opts options, diags *diagnostics) {
+	// Map of npm packages to import paths to the first file using them
+	importPaths := map[string]map[string]string{}
+	for _, file := range files {
+		details := getExportDetails(file, opts)
+		if file.GetPackage() == googleProtobufPrefix || (isGooglePackage(file.GetPackage()) && details.npmPackage == "") {
+			continue
+		}
+		fileDiags := diags.forFile(file)
+		npmPackage, importPath := details.npmPackage, details.importPath
+		switch {
+		case npmPackage == "":
+			fileDiags.add(nil, "all imported files must specify the option (tsjson.npm_package), or be mapped to an npm package with an M or P parameter")
+		case len(npmPackage) > maxNpmPackageLength || !npmPackageName.MatchString(npmPackage):
+			fileDiags.add(fileOptionsNpmPackagePath, "(tsjson.npm_package) %q is not a valid npm package name", npmPackage)
+		}
+		if importPath == "" {
+			// Files without any types or services can't be imported from, so they don't need to say where they are
+			if len(file.GetMessageType()) > 0 || len(file.GetEnumType()) > 0 || len(file.GetService()) > 0 {
+				fileDiags.add(nil, "files declaring messages, enums or services must specify the option (tsjson.import_path), or be mapped to an import path with an M or P parameter")
+			}
+			continue
+		}
+		sourcePath, source := describeImportPath(file, opts, importPath)
+		if problem := checkImportPath(importPath); problem != "" {
+			fileDiags.add(sourcePath, "%s %s", source, problem)
+			continue
+		}
+		pkgPaths, ok := importPaths[npmPackage]
+		if !ok {
+			pkgPaths = map[string]string{}
+			importPaths[npmPackage] = pkgPaths
+		}
+		if other, ok := pkgPaths[importPath]; ok {
+			fileDiags.add(sourcePath, "%s is already used by %s in npm package %s", source, other, npmPackage)
+			continue
+		}
+		pkgPaths[importPath] = file.GetName()
+	}
+}
+
+// describeImportPath says where the file's import path came from for diagnostics, along with the location path to report them at.
+// Only paths set by the file's own (tsjson.import_path) option are reported at the option, anything derived from the plugin parameters is reported at the file.
+func describeImportPath(f *descriptorpb.FileDescriptorProto, opts options, importPath string) ([]int32, string) {
+	if _, ok := opts.fileMappings[f.GetName()]; ok {
+		return nil, fmt.Sprintf("import path %q from parameter M%s", importPath, f.GetName())
+	}
+	if _, ok := opts.packageMappings[f.GetPackage()]; ok {
+		return nil, fmt.Sprintf("import path %q derived from parameter P%s", importPath, f.GetPackage())
+	}
+	if opts.paths != pathsImport {
+		return nil, fmt.Sprintf("output path %q derived with paths=%s", importPath, opts.paths)
+	}
+	if optionPath, _ := proto.GetExtension(f.GetOptions(), tsjsonpb.E_ImportPath).(string); optionPath == importPath {
+		return fileOptionsImportPathPath, fmt.Sprintf("(tsjson.import_path) %q", importPath)
+	}
+	return nil, fmt.Sprintf("import path %q derived from google_import_root", importPath)
+}
+
+// checkImportPath describes what is wrong with an import path, or returns an empty string if it is valid.
+// Import paths are relative to the root of the npm package, use forward slashes and leave out the extension, e.g. "test/root".
+func checkImportPath(importPath string) string {
+	switch {
+	case strings.Contains(importPath, `\`):
+		return "must use forward slashes"
+	case strings.HasPrefix(importPath, "/"):
+		return "must be relative to the root of the npm package"
+	case strings.HasSuffix(importPath, "/"):
+		return "must name a file, not a directory"
+	case strings.HasSuffix(importPath, ".ts") || strings.HasSuffix(importPath, ".js"):
+		return "must not include a file extension"
+	}
+	for _, segment := range strings.Split(importPath, "/") {
+		switch segment {
+		case "":
+			return "must not contain empty path segments"
+		case ".", "..":
+			return "must not contain relative path segments"
+		}
+	}
+	return ""
+}
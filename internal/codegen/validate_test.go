@@ -0,0 +1,88 @@
+package codegen
+
+import "testing"
+
+func TestCheckImportPath(t *testing.T) {
+	tests := []struct {
+		importPath string
+		want       string
+	}{
+		{importPath: "root", want: ""},
+		{importPath: "test/root", want: ""},
+		{importPath: "gen/google/type/money", want: ""},
+		{importPath: "root.pb", want: ""},
+		{importPath: `test\root`, want: "must use forward slashes"},
+		{importPath: "/test/root", want: "must be relative to the root of the npm package"},
+		{importPath: "test/", want: "must name a file, not a directory"},
+		{importPath: "test/root.ts", want: "must not include a file extension"},
+		{importPath: "test/root.js", want: "must not include a file extension"},
+		{importPath: "test//root", want: "must not contain empty path segments"},
+		{importPath: "", want: "must not contain empty path segments"},
+		{importPath: "./root", want: "must not contain relative path segments"},
+		{importPath: "test/../root", want: "must not contain relative path segments"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.importPath, func(t *testing.T) {
+			if got := checkImportPath(tt.importPath); got != tt.want {
+				t.Errorf("checkImportPath(%q) = %q, want %q", tt.importPath, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileOptionsAreValidated(t *testing.T) {
+	tests := []struct {
+		name        string
+		files       []string
+		diagnostics []string
+	}{
+		{
+			name:  "no options",
+			files: []string{`name: "a.proto" package: "a" syntax: "proto3" message_type { name: "A" }`},
+			diagnostics: []string{
+				"a.proto: all imported files must specify the option (tsjson.npm_package), or be mapped to an npm package with an M or P parameter",
+				"a.proto: files declaring messages, enums or services must specify the option (tsjson.import_path), or be mapped to an import path with an M or P parameter",
+			},
+		},
+		{
+			name:        "invalid npm package",
+			files:       []string{`name: "a.proto" package: "a" syntax: "proto3" options { [tsjson.npm_package]: "Acme" [tsjson.import_path]: "a" } message_type { name: "A" }`},
+			diagnostics: []string{`a.proto: (tsjson.npm_package) "Acme" is not a valid npm package name`},
+		},
+		{
+			name:        "invalid import path",
+			files:       []string{`name: "a.proto" package: "a" syntax: "proto3" options { [tsjson.npm_package]: "acme" [tsjson.import_path]: "a.ts" } message_type { name: "A" }`},
+			diagnostics: []string{`a.proto: (tsjson.import_path) "a.ts" must not include a file extension`},
+		},
+		{
+			name: "duplicate import path",
+			files: []string{
+				`name: "a.proto" package: "a" syntax: "proto3" options { [tsjson.npm_package]: "acme" [tsjson.import_path]: "x" } message_type { name: "A" }`,
+				`name: "b.proto" package: "b" syntax: "proto3" options { [tsjson.npm_package]: "acme" [tsjson.import_path]: "x" } message_type { name: "B" }`,
+			},
+			diagnostics: []string{`b.proto: (tsjson.import_path) "x" is already used by a.proto in npm package acme`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := generate(t, "", tt.files...)
+			assertDiagnostics(t, err, tt.diagnostics...)
+		})
+	}
+}
+
+func TestImportPathIsOptionalForEmptyFiles(t *testing.T) {
+	if _, err := generate(t, "", `name: "a.proto" package: "a" syntax: "proto3" options { [tsjson.npm_package]: "acme" }`); err != nil {
+		t.Errorf("generation failed: %v", err)
+	}
+}
+
+func TestDuplicateDerivedOutputPaths(t *testing.T) {
+	// Both files have their own import paths, but paths=package derives the same output path for each, and that is reported at the file rather than the option
+	_, err := generate(t, "paths=package",
+		`name: "a/x.proto" package: "acme" syntax: "proto3" options { [tsjson.npm_package]: "acme" [tsjson.import_path]: "one" } message_type { name: "A" }`,
+		`name: "b/x.proto" package: "acme" syntax: "proto3" options { [tsjson.npm_package]: "acme" [tsjson.import_path]: "two" } message_type { name: "B" }
+source_code_info { location { path: [8, 210321] span: [2, 0, 37] } }`,
+	)
+	assertDiagnostics(t, err, `b/x.proto: output path "acme/x" derived with paths=package is already used by a/x.proto in npm package acme`)
+}
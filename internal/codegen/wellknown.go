@@ -0,0 +1,79 @@
+package codegen
+
+import (
+	"errors"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// wrapperTypes maps each wrapper well-known type to the scalar type of its value.
+// Wrappers are generated as their bare value in typescript and protojson alike, with undefined (or null on the wire) meaning unset, so e.g. a google.protobuf.Int64Value field is a number written as a string.
+var wrapperTypes = map[string]descriptorpb.FieldDescriptorProto_Type{
+	".google.protobuf.DoubleValue": descriptorpb.FieldDescriptorProto_TYPE_DOUBLE,
+	".google.protobuf.FloatValue":  descriptorpb.FieldDescriptorProto_TYPE_FLOAT,
+	".google.protobuf.Int64Value":  descriptorpb.FieldDescriptorProto_TYPE_INT64,
+	".google.protobuf.UInt64Value": descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+	".google.protobuf.Int32Value":  descriptorpb.FieldDescriptorProto_TYPE_INT32,
+	".google.protobuf.UInt32Value": descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+	".google.protobuf.BoolValue":   descriptorpb.FieldDescriptorProto_TYPE_BOOL,
+	".google.protobuf.StringValue": descriptorpb.FieldDescriptorProto_TYPE_STRING,
+	".google.protobuf.BytesValue":  descriptorpb.FieldDescriptorProto_TYPE_BYTES,
+}
+
+// isWrapperType reports whether the fully qualified type name is one of the wrapper well-known types
+func isWrapperType(typeName string) bool {
+	_, ok := wrapperTypes[typeName]
+	return ok
+}
+
+// runtimeTypes are the google.protobuf types exported by the runtime besides the wrappers, every other google.protobuf type (e.g. google.protobuf.Api or the descriptor.proto messages) has no typescript equivalent and can't be used
+var runtimeTypes = map[string]bool{
+	".google.protobuf.Any":       true,
+	".google.protobuf.Timestamp": true,
+	".google.protobuf.Duration":  true,
+	".google.protobuf.Struct":    true,
+	".google.protobuf.FieldMask": true,
+	".google.protobuf.ListValue": true,
+	".google.protobuf.Value":     true,
+	".google.protobuf.NullValue": true,
+	".google.protobuf.Empty":     true,
+}
+
+// isRuntimeType reports whether the fully qualified type name is a google.protobuf type provided by the runtime, including the wrappers which are generated as bare values
+func isRuntimeType(typeName string) bool {
+	return runtimeTypes[typeName] || isWrapperType(typeName)
+}
+
+// isNullValue reports whether the field is a google.protobuf.NullValue, which has no representation outside of oneofs
+func isNullValue(field *descriptorpb.FieldDescriptorProto) bool {
+	return field.GetTypeName() == ".google.protobuf.NullValue"
+}
+
+// errNullValue is reported for NullValue fields outside of oneofs, whether singular, repeated or map values.
+// Their only value is null, which can't be told apart from the field being unset, so only a oneof case can carry one (see oneof.go).
+var errNullValue = errors.New("google.protobuf.NullValue is only supported as a oneof member")
+
+// unwrapField returns a copy of a wrapper typed field with the type of the wrapped value instead, so it is generated exactly like a scalar field with explicit presence.
+// Fields of any other type are returned as they are.
+func unwrapField(field *descriptorpb.FieldDescriptorProto) *descriptorpb.FieldDescriptorProto {
+	valueType, ok := wrapperTypes[field.GetTypeName()]
+	if !ok || field.GetType() != descriptorpb.FieldDescriptorProto_TYPE_MESSAGE {
+		return field
+	}
+	unwrapped := proto.Clone(field).(*descriptorpb.FieldDescriptorProto)
+	unwrapped.Type = valueType.Enum()
+	unwrapped.TypeName = nil
+	return unwrapped
+}
+
+// wellKnownHelpers maps the well-known types which have a protojson representation of their own to the name of their helpers in the runtime, e.g. tsjson.ToProtoJSON.Timestamp and tsjson.Parse.Timestamp.
+// Each is still generated as its google.protobuf class, but written and read as e.g. an RFC 3339 string rather than an object of its fields.
+var wellKnownHelpers = map[string]string{
+	".google.protobuf.Timestamp": "Timestamp",
+	".google.protobuf.Duration":  "Duration",
+	".google.protobuf.FieldMask": "FieldMask",
+	".google.protobuf.Struct":    "Struct",
+	".google.protobuf.Value":     "Value",
+	".google.protobuf.ListValue": "ListValue",
+}
@@ -0,0 +1,153 @@
+package codegen
+
+import "testing"
+
+func TestNullValueOneofMembers(t *testing.T) {
+	content := generateFile(t, "", "test.ts", proto3File(`
+message_type {
+	name: "Example"
+	field { name: "text" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING oneof_index: 0 }
+	field { name: "nothing" number: 2 label: LABEL_OPTIONAL type: TYPE_ENUM type_name: ".google.protobuf.NullValue" oneof_index: 0 }
+	field { name: "none" number: 3 label: LABEL_OPTIONAL type: TYPE_ENUM type_name: ".google.protobuf.NullValue" oneof_index: 1 }
+	oneof_decl { name: "mixed" }
+	oneof_decl { name: "only" }
+}`))
+	assertContains(t, content,
+		`public mixed?: { case: "text", value: string } | { case: "nothing", value: null };`,
+		`public only?: { case: "none", value: null };`,
+		`nothing: this.mixed?.case === "nothing" ? null : undefined,`,
+		`none: this.only?.case === "none" ? null : undefined,`,
+		`{ case: "nothing", value: await tsjson.Parse.NullValue(objData, "nothing", "nothing") },`,
+		`{ case: "none", value: await tsjson.Parse.NullValue(objData, "none", "none") },`,
+	)
+}
+
+func TestNullValueOutsideOneofs(t *testing.T) {
+	tests := []struct {
+		name  string
+		field string
+	}{
+		{name: "singular", field: `field { name: "nothing" number: 1 label: LABEL_OPTIONAL type: TYPE_ENUM type_name: ".google.protobuf.NullValue" }`},
+		{name: "repeated", field: `field { name: "nothing" number: 1 label: LABEL_REPEATED type: TYPE_ENUM type_name: ".google.protobuf.NullValue" }`},
+		{name: "map value", field: `field { name: "nothing" number: 1 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".test.Example.NothingEntry" }
+	nested_type {
+		name: "NothingEntry"
+		field { name: "key" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING }
+		field { name: "value" number: 2 label: LABEL_OPTIONAL type: TYPE_ENUM type_name: ".google.protobuf.NullValue" }
+		options { map_entry: true }
+	}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := generate(t, "", proto3File(`
+message_type {
+	name: "Example"
+	`+tt.field+`
+}`))
+			assertDiagnostics(t, err, "test.proto: test.Example.nothing: google.protobuf.NullValue is only supported as a oneof member")
+		})
+	}
+}
+
+func TestWrappersAreUnwrapped(t *testing.T) {
+	content := generateFile(t, "", "test.ts", proto3File(`dependency: "google/protobuf/wrappers.proto"
+message_type {
+	name: "Example"
+	field { name: "big" number: 1 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".google.protobuf.Int64Value" }
+	field { name: "text" number: 2 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".google.protobuf.StringValue" }
+	field { name: "blobs" number: 3 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".google.protobuf.BytesValue" }
+	field { name: "ratio" number: 4 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".google.protobuf.FloatValue" oneof_index: 0 }
+	field { name: "count" number: 5 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".google.protobuf.UInt32Value" oneof_index: 0 }
+	field { name: "scores" number: 6 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".test.Example.ScoresEntry" }
+	field { name: "flag" number: 7 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".google.protobuf.BoolValue" }
+	nested_type {
+		name: "ScoresEntry"
+		field { name: "key" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING }
+		field { name: "value" number: 2 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".google.protobuf.DoubleValue" }
+		options { map_entry: true }
+	}
+	oneof_decl { name: "choice" }
+}`))
+	assertContains(t, content,
+		"public big?: number;",
+		"public text?: string;",
+		"public blobs?: Uint8Array[];",
+		`public choice?: { case: "ratio", value: number } | { case: "count", value: number };`,
+		"public scores?: ReadonlyMap<string, number | null>;",
+		"public flag?: boolean;",
+		// Wrappers have explicit presence, so their zero values are written
+		"big: tsjson.ToProtoJSON.StringNumber(this.big),",
+		"text: tsjson.ToProtoJSON.String(this.text),",
+		"blobs: tsjson.ToProtoJSON.Repeated(tsjson.ToProtoJSON.Bytes, this.blobs),",
+		`ratio: this.choice?.case === "ratio" ? tsjson.ToProtoJSON.Number(this.choice.value) : undefined,`,
+		"scores: tsjson.ToProtoJSON.Map(tsjson.ToProtoJSON.Number, this.scores),",
+		"flag: tsjson.ToProtoJSON.Bool(this.flag),",
+		`res.big = await tsjson.Parse.Number(objData, "big", "big");`,
+		`res.blobs = await tsjson.Parse.Repeated(objData, "blobs", "blobs", tsjson.PrimitiveParse.Bytes());`,
+		`{ case: "count", value: await tsjson.Parse.Number(objData, "count", "count") },`,
+		`res.scores = await tsjson.Parse.Map(objData, "scores", "scores", tsjson.MapKeys.ParseString, tsjson.PrimitiveParse.Number());`,
+	)
+	// Nothing is imported for them
+	assertNotContains(t, content, "google")
+}
+
+func TestWrapperMethodTypes(t *testing.T) {
+	_, err := generate(t, "", proto3File(`dependency: "google/protobuf/wrappers.proto"
+message_type { name: "Req" }
+service {
+	name: "Svc"
+	method { name: "Get" input_type: ".test.Req" output_type: ".google.protobuf.StringValue" }
+	method { name: "Put" input_type: ".google.protobuf.Int32Value" output_type: ".test.Req" }
+}`))
+	assertDiagnostics(t, err,
+		"test.proto: test.Svc.Get: wrapper type google.protobuf.StringValue can't be used as a method input or output, use a message containing it instead",
+		"test.proto: test.Svc.Put: wrapper type google.protobuf.Int32Value can't be used as a method input or output, use a message containing it instead",
+	)
+}
+
+func TestWellKnownTypeCodecs(t *testing.T) {
+	content := generateFile(t, "", "test.ts", proto3File(`dependency: "google/protobuf/timestamp.proto"
+message_type {
+	name: "Example"
+	field { name: "ts" number: 1 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".google.protobuf.Timestamp" }
+	field { name: "durs" number: 2 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".google.protobuf.Duration" }
+	field { name: "any" number: 3 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".google.protobuf.Any" }
+	field { name: "str" number: 4 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".google.protobuf.Struct" }
+	field { name: "val" number: 5 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".google.protobuf.Value" }
+	field { name: "list" number: 6 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".google.protobuf.ListValue" }
+	field { name: "mask" number: 7 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".google.protobuf.FieldMask" }
+	field { name: "empty" number: 8 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".google.protobuf.Empty" oneof_index: 0 }
+	field { name: "times" number: 9 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".test.Example.TimesEntry" }
+	nested_type {
+		name: "TimesEntry"
+		field { name: "key" number: 1 label: LABEL_OPTIONAL type: TYPE_INT64 }
+		field { name: "value" number: 2 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".google.protobuf.Timestamp" }
+		options { map_entry: true }
+	}
+	oneof_decl { name: "choice" }
+}`))
+	assertContains(t, content,
+		`import { google } from "@llkennedy/protoc-gen-tsjson";`,
+		"public ts?: google.protobuf.Timestamp;",
+		"public durs?: google.protobuf.Duration[];",
+		`public choice?: { case: "empty", value: google.protobuf.Empty };`,
+		"public times?: ReadonlyMap<number, google.protobuf.Timestamp | null>;",
+		"ts: tsjson.ToProtoJSON.Timestamp(this.ts),",
+		"durs: tsjson.ToProtoJSON.Repeated(tsjson.ToProtoJSON.Duration, this.durs),",
+		"any: this.any?.ToProtoJSON(),",
+		"str: tsjson.ToProtoJSON.Struct(this.str),",
+		"val: tsjson.ToProtoJSON.Value(this.val),",
+		"list: tsjson.ToProtoJSON.ListValue(this.list),",
+		"mask: tsjson.ToProtoJSON.FieldMask(this.mask),",
+		"times: tsjson.ToProtoJSON.Map(tsjson.ToProtoJSON.Timestamp, this.times),",
+		`res.ts = await tsjson.Parse.Timestamp(objData, "ts", "ts");`,
+		`res.durs = await tsjson.Parse.Repeated(objData, "durs", "durs", tsjson.PrimitiveParse.Duration());`,
+		`res.any = await tsjson.Parse.Message(objData, "any", "any", google.protobuf.Any.Parse);`,
+		`res.str = await tsjson.Parse.Struct(objData, "str", "str");`,
+		`res.val = await tsjson.Parse.Value(objData, "val", "val");`,
+		`res.list = await tsjson.Parse.ListValue(objData, "list", "list");`,
+		`res.mask = await tsjson.Parse.FieldMask(objData, "mask", "mask");`,
+		`{ case: "empty", value: await tsjson.Parse.Message(objData, "empty", "empty", google.protobuf.Empty.Parse) },`,
+		`res.times = await tsjson.Parse.Map(objData, "times", "times", tsjson.MapKeys.ParseInt64, tsjson.PrimitiveParse.Timestamp());`,
+	)
+}
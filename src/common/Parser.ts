@@ -9,6 +9,9 @@ export type RepeatedParser<T> = (res: any[]) => Promise<T[]>;
 /** These are all allowed basic types returned by the typeof accessor */
 export type TypeStrings = "string" | "number" | "bigint" | "boolean" | "symbol" | "undefined" | "object" | "function";
 
+/** A possible member of a oneof, which may or may not have been present in the parsed data */
+export type OneofCandidate<T> = T extends { case: infer C, value: infer V } ? { case: C, value: V | undefined } : never;
+
 /** Converts data structured as "any" to explicitly Object type, only supports string parsing and object assertion at present. */
 export function AnyToObject(res: any): Object {
 	switch (typeof res) {
@@ -49,12 +52,19 @@ export class ToProtoJSON {
 	public static Message<T extends ProtoJSONCompatible>(req?: T): Object | undefined {
 		return req?.ToProtoJSON()
 	}
-	/** Write an enum which could be either strings or numbers. This is NOT fully type safe, if EnumMap is not the Object.keys of the actual enum T, bad things will happen */
-	public static Enum<T>(map: T, val?: number): string | undefined {
+	/** Write an enum which could be either strings or numbers. This is NOT fully type safe, if EnumMap is not the Object.keys of the actual enum T, bad things will happen.
+	 * 
+	 * Values without a name in the enum (unknown values kept by open enums) are written as numbers, as protojson requires.
+	 */
+	public static Enum<T>(map: T, val?: number): string | number | undefined {
 		if (val === undefined) {
 			return undefined;
 		}
-		return map[val];
+		let name = map[val];
+		if (typeof name !== "string") {
+			return val;
+		}
+		return name;
 	}
 	/** Write a map, providing individual parsers for key and value instances */
 	public static Map<K, V, outV = any>(valToProtoJSON: (val: V) => outV, data?: ReadonlyMap<K, V | null>): { [key: string]: outV | null } | undefined {
@@ -82,6 +92,13 @@ export class ToProtoJSON {
 		}
 		return out;
 	}
+	/** Drop the zero value of a field with implicit presence, since canonical protojson omits it. NaN and -0 are not zero values. */
+	public static NonZero<T>(data?: T): T | undefined {
+		if (data === false || data === "" || Object.is(data, 0) || (data instanceof Uint8Array && data.length === 0)) {
+			return undefined;
+		}
+		return data;
+	}
 	/** Write a boolean */
 	public static Bool(data?: boolean): boolean | undefined {
 		return data;
@@ -117,15 +134,24 @@ export class ToProtoJSON {
 		return data;
 	}
 	/** Write a google Timestamp */
-	public static Timestamp(data?: Date): string | undefined {
-		return new google.protobuf.Timestamp(data).ToProtoJSON();
+	public static Timestamp(data?: Date | google.protobuf.Timestamp): string | undefined {
+		if (data instanceof Date) {
+			data = new google.protobuf.Timestamp(data);
+		}
+		return data?.ToProtoJSON();
 	}
 	/** Write a google Duration */
-	public static Duration(durationSeconds?: number): string | undefined {
-		return new google.protobuf.Duration(durationSeconds).ToProtoJSON();
+	public static Duration(data?: number | google.protobuf.Duration): string | undefined {
+		if (typeof data === "number") {
+			data = new google.protobuf.Duration(data);
+		}
+		return data?.ToProtoJSON();
 	}
 	/** Write a google Struct */
-	public static Struct(data?: Object): Object | undefined {
+	public static Struct(data?: Object | google.protobuf.Struct): Object | undefined {
+		if (data instanceof google.protobuf.Struct) {
+			return data.ToProtoJSON();
+		}
 		return data;
 	}
 	/** Write a google Wrapper */
@@ -133,15 +159,21 @@ export class ToProtoJSON {
 		return new google.protobuf.Wrapper().ToProtoJSON();
 	}
 	/** Write a google FieldMask */
-	public static FieldMask(): any | undefined {
-		return new google.protobuf.FieldMask().ToProtoJSON();
+	public static FieldMask(data?: google.protobuf.FieldMask): string | undefined {
+		return data?.ToProtoJSON();
 	}
 	/** Write a google ListValue */
-	public static ListValue(): any[] | undefined {
-		return new google.protobuf.ListValue().ToProtoJSON();
+	public static ListValue(data?: any[] | google.protobuf.ListValue): any[] | undefined {
+		if (data instanceof google.protobuf.ListValue) {
+			return data.ToProtoJSON();
+		}
+		return data;
 	}
 	/** Write a google Value */
 	public static Value(data?: any): any | undefined {
+		if (data instanceof google.protobuf.Value) {
+			return data.ToProtoJSON();
+		}
 		return data;
 	}
 	/** Write a google NullValue */
@@ -165,9 +197,10 @@ export class Parse {
 	public static async Message<T>(obj: Object, prop: string, altProp: string, parser: Parser<T>): Promise<T | undefined> {
 		return ParseIfNotNull(obj, prop, altProp, PrimitiveParse.Message<T>(parser), ["object"]);
 	}
-	/** Parse an enum which could be either strings or numbers. This is NOT fully type safe, if map is not the Object.keys of the actual enum T, bad things will happen */
-	public static async Enum<T>(obj: Object, prop: string, altProp: string, map: T): Promise<any | undefined> {
-		return ParseIfNotNull(obj, prop, altProp, PrimitiveParse.Enum<T>(map), ["string", "number"]);
+	/** Parse an enum which could be either strings or numbers. This is NOT fully type safe, if map is not the Object.keys of the actual enum T, bad things will happen.
+	 * Unknown numeric values are only accepted for open enums, by setting allowUnknown. */
+	public static async Enum<T>(obj: Object, prop: string, altProp: string, map: T, allowUnknown: boolean = false): Promise<any | undefined> {
+		return ParseIfNotNull(obj, prop, altProp, PrimitiveParse.Enum<T>(map, allowUnknown), ["string", "number"]);
 	}
 	/** Parse a map, providing individual parsers for key and value instances */
 	public static async Map<K, V>(obj: Object, prop: string, altProp: string, keyParse: (key: string) => Promise<K>, valParse: (val: any) => Promise<V | undefined>): Promise<ReadonlyMap<K, V | null> | undefined> {
@@ -193,21 +226,42 @@ export class Parse {
 	public static async Number(obj: Object, prop: string, altProp: string): Promise<number | undefined> {
 		return ParseIfNotNull(obj, prop, altProp, PrimitiveParse.Number(), ["string", "number"]);
 	}
+	/** Check a required field was present in the parsed data */
+	public static Required<T>(name: string, val: T | undefined): T {
+		if (val === undefined) {
+			throw new Error(`missing required field ${name}`);
+		}
+		return val;
+	}
+	/** Select the single member of a oneof present in the parsed data, throwing an error if more than one member was set */
+	public static Oneof<T extends { case: string, value: any }>(name: string, candidates: OneofCandidate<T>[]): T | undefined {
+		let found: OneofCandidate<T> | undefined;
+		for (let candidate of candidates) {
+			if (candidate.value === undefined) {
+				continue;
+			}
+			if (found !== undefined) {
+				throw new Error(`multiple fields set for oneof ${name}: found both ${found.case} and ${candidate.case}`);
+			}
+			found = candidate;
+		}
+		return found as T | undefined;
+	}
 	/** Parse a google Any */
 	public static async Any(obj: Object, prop: string, altProp: string): Promise<google.protobuf.Any | undefined> {
 		return ParseIfNotNull(obj, prop, altProp, google.protobuf.Any.Parse)
 	}
 	/** Parse a google Timestamp */
 	public static async Timestamp(obj: Object, prop: string, altProp: string): Promise<google.protobuf.Timestamp | undefined> {
-		return ParseIfNotNull(obj, prop, altProp, google.protobuf.Timestamp.Parse)
+		return ParseIfNotNull(obj, prop, altProp, google.protobuf.Timestamp.Parse, ["string"]);
 	}
 	/** Parse a google Duration */
 	public static async Duration(obj: Object, prop: string, altProp: string): Promise<google.protobuf.Duration | undefined> {
-		return ParseIfNotNull(obj, prop, altProp, google.protobuf.Duration.Parse)
+		return ParseIfNotNull(obj, prop, altProp, google.protobuf.Duration.Parse, ["string"]);
 	}
 	/** Parse a google Struct */
 	public static async Struct(obj: Object, prop: string, altProp: string): Promise<google.protobuf.Struct | undefined> {
-		return ParseIfNotNull(obj, prop, altProp, google.protobuf.Struct.Parse)
+		return ParseIfNotNull(obj, prop, altProp, google.protobuf.Struct.Parse, ["object"]);
 	}
 	/** Parse a google Wrapper */
 	public static async Wrapper(obj: Object, prop: string, altProp: string): Promise<google.protobuf.Wrapper | undefined> {
@@ -215,20 +269,40 @@ export class Parse {
 	}
 	/** Parse a google FieldMask */
 	public static async FieldMask(obj: Object, prop: string, altProp: string): Promise<google.protobuf.FieldMask | undefined> {
-		return ParseIfNotNull(obj, prop, altProp, google.protobuf.FieldMask.Parse)
+		return ParseIfNotNull(obj, prop, altProp, google.protobuf.FieldMask.Parse, ["string"]);
 	}
 	/** Parse a google ListValue */
 	public static async ListValue(obj: Object, prop: string, altProp: string): Promise<google.protobuf.ListValue | undefined> {
-		return ParseIfNotNull(obj, prop, altProp, google.protobuf.ListValue.Parse)
+		return ParseIfNotNull(obj, prop, altProp, google.protobuf.ListValue.Parse, ["object"]);
 	}
 	/** Parse a google Value */
 	public static async Value(obj: Object, prop: string, altProp: string): Promise<google.protobuf.Value | undefined> {
-		return ParseIfNotNull(obj, prop, altProp, google.protobuf.Value.Parse)
+		let parsed = await ParseIfNotNull(obj, prop, altProp, google.protobuf.Value.Parse);
+		if (parsed !== undefined) {
+			return parsed;
+		}
+		// Unlike every other type, a null Value is set: it holds the JSON null
+		for (let key of [prop, altProp]) {
+			if (obj.hasOwnProperty(key) && obj[key] === null) {
+				return new google.protobuf.Value(null);
+			}
+		}
+		return undefined;
 	}
-	/** Parse a google NullValue */
-	public static async NullValue(): Promise<null> {
-		// I don't know why anyone would ever use this type
-		return null
+	/** Parse a google NullValue, which is only supported as a oneof member. Unlike every other type a null value means the member is set, so this resolves null when the property is present and undefined when it isn't */
+	public static async NullValue(obj: Object, prop: string, altProp: string): Promise<null | undefined> {
+		for (let key of [prop, altProp]) {
+			if (!obj.hasOwnProperty(key)) {
+				continue;
+			}
+			let found = obj[key];
+			// Protojson writes null, but also accepts the enum value's name or number
+			if (found === null || found === "NULL_VALUE" || found === 0) {
+				return null;
+			}
+			throw new Error(`invalid value for NullValue property ${key}, expected null but found ${JSON.stringify(found)}`);
+		}
+		return undefined;
 	}
 	/** Parse a google Empty */
 	public static async Empty(obj: Object, prop: string, altProp: string): Promise<google.protobuf.Empty | undefined> {
@@ -245,7 +319,7 @@ export class PrimitiveParse {
 			return parser(raw);
 		}
 	}
-	public static Enum<T>(map: T): Parser<any> {
+	public static Enum<T>(map: T, allowUnknown: boolean = false): Parser<any> {
 		return async raw => {
 			if (typeof raw === "string" && raw === "") {
 				// Empty string is the zero value
@@ -254,7 +328,7 @@ export class PrimitiveParse {
 			switch (typeof raw) {
 				case "number":
 					let mappedStr = map[raw];
-					if (mappedStr === undefined) {
+					if (mappedStr === undefined && !allowUnknown) {
 						throw new Error(`undefined enum value: ${raw}`);
 					}
 					return raw as unknown as T;
@@ -276,7 +350,8 @@ export class PrimitiveParse {
 			}
 			let out = new Map<K, V | null>();
 			for (let key in raw) {
-				out.set(await keyParse(key), await valParse(raw[key]) ?? null);
+				const val = raw[key];
+				out.set(await keyParse(key), val === null ? null : await valParse(val) ?? null);
 			}
 			return out;
 		}
@@ -317,6 +392,25 @@ export class PrimitiveParse {
 			return base64.parse(raw);
 		}
 	}
+	public static Timestamp(): Parser<google.protobuf.Timestamp> {
+		return google.protobuf.Timestamp.Parse;
+	}
+	public static Duration(): Parser<google.protobuf.Duration> {
+		return google.protobuf.Duration.Parse;
+	}
+	public static FieldMask(): Parser<google.protobuf.FieldMask> {
+		return google.protobuf.FieldMask.Parse;
+	}
+	public static Struct(): Parser<google.protobuf.Struct> {
+		return google.protobuf.Struct.Parse;
+	}
+	public static ListValue(): Parser<google.protobuf.ListValue> {
+		return google.protobuf.ListValue.Parse;
+	}
+	/** Values can be any JSON including null, so unlike the other parsers this never rejects its input */
+	public static Value(): Parser<google.protobuf.Value> {
+		return google.protobuf.Value.Parse;
+	}
 	/** int32, fixed32, uint32, int64, fixed64, uint64, float, double - all work on identical logic other than range checking */
 	public static Number(rangeCheck?: (num: number) => boolean, allowSpecial: boolean = false): Parser<number> {
 		return async raw => {
@@ -343,12 +437,60 @@ export class PrimitiveParse {
 	}
 }
 
+/** Parses an integer map key in decimal, checking it is within the range of its type given by the decimal strings min and max */
+function ParseIntegerKey(raw: string, min: string, max: string): number {
+	const match = /^(-?)0*(\d+)$/.exec(raw);
+	if (match === null) {
+		throw new Error(`invalid integer map key ${raw}`);
+	}
+	// The bounds are compared as decimal strings, as 64-bit bounds can't be represented exactly as numbers
+	const negative = match[1] === "-" && match[2] !== "0";
+	const bound = negative ? min : max;
+	if ((negative && bound[0] !== "-") || CompareDigits(match[2], negative ? bound.substring(1) : bound) > 0) {
+		throw new Error(`map key ${raw} is out of range`);
+	}
+	return Number(raw);
+}
+
+/** Compares two unsigned decimal integers without leading zeros, returning a negative number, zero or a positive number as a is less than, equal to or greater than b */
+function CompareDigits(a: string, b: string): number {
+	if (a.length !== b.length) {
+		return a.length - b.length;
+	}
+	return a < b ? -1 : a > b ? 1 : 0;
+}
+
+/** Parsers for map keys, which are always strings in protojson */
 export class MapKeys {
 	public static async ParseString(raw: string): Promise<string> {
 		return raw;
 	}
+	/** bool keys are written as "true" or "false" */
 	public static async ParseBool(raw: string): Promise<boolean> {
-		return raw === "true";
+		switch (raw) {
+			case "true":
+				return true;
+			case "false":
+				return false;
+			default:
+				throw new Error(`invalid bool map key ${raw}`);
+		}
+	}
+	/** int32, sint32, sfixed32 */
+	public static async ParseInt32(raw: string): Promise<number> {
+		return ParseIntegerKey(raw, "-2147483648", "2147483647");
+	}
+	/** uint32, fixed32 */
+	public static async ParseUint32(raw: string): Promise<number> {
+		return ParseIntegerKey(raw, "0", "4294967295");
+	}
+	/** int64, sint64, sfixed64 */
+	public static async ParseInt64(raw: string): Promise<number> {
+		return ParseIntegerKey(raw, "-9223372036854775808", "9223372036854775807");
+	}
+	/** uint64, fixed64 */
+	public static async ParseUint64(raw: string): Promise<number> {
+		return ParseIntegerKey(raw, "0", "18446744073709551615");
 	}
 	public static async Number(raw: string): Promise<number> {
 		return Number(raw);
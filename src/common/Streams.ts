@@ -0,0 +1,103 @@
+import { Parser } from "./Parser";
+import { ProtoJSONCompatible } from "./ProtoJSONCompatible";
+import { StreamConnection, StreamTransport } from "./Transport";
+
+/** Messages sent on a client stream, either as an (async) iterable or a MessageWriter */
+export type Streamable<T> = AsyncIterable<T> | Iterable<T>;
+
+/** A writable handle for client streams, messages passed to Send are sent in order until Close is called */
+export class MessageWriter<T> implements AsyncIterable<T> {
+	private queue: T[] = [];
+	private closed = false;
+	private waiting?: () => void;
+	/** Queue a message to be sent */
+	public Send(msg: T) {
+		if (this.closed) {
+			throw new Error("cannot send on a closed MessageWriter");
+		}
+		this.queue.push(msg);
+		this.wake();
+	}
+	/** Finish the stream once all queued messages are sent */
+	public Close() {
+		this.closed = true;
+		this.wake();
+	}
+	public async *[Symbol.asyncIterator](): AsyncIterator<T> {
+		while (true) {
+			let next = this.queue.shift();
+			if (next !== undefined) {
+				yield next;
+				continue;
+			}
+			if (this.closed) {
+				return;
+			}
+			await new Promise<void>(resolve => this.waiting = resolve);
+		}
+	}
+	private wake() {
+		let waiting = this.waiting;
+		this.waiting = undefined;
+		waiting?.();
+	}
+}
+
+/** Implementations of the streaming RPC types used by generated service clients */
+export class Stream {
+	/** Send a client stream, resolving with the single response from the server */
+	public static async Client<Req extends ProtoJSONCompatible, Res>(transport: StreamTransport, path: string, reqs: Streamable<Req>, parser: Parser<Res>): Promise<Res> {
+		let conn = await transport.Stream(path);
+		try {
+			await SendAll(conn, reqs);
+			for await (let frame of conn.Receive()) {
+				return await parser(frame);
+			}
+			throw new Error(`stream ${path} closed without a response`);
+		} finally {
+			await conn.Close();
+		}
+	}
+	/** Send a single request, then receive each message of the server stream */
+	public static async *Server<Req extends ProtoJSONCompatible, Res>(transport: StreamTransport, path: string, req: Req, parser: Parser<Res>): AsyncIterable<Res> {
+		let conn = await transport.Stream(path);
+		try {
+			await conn.Send(req.ToProtoJSON());
+			await conn.CloseSend();
+			for await (let frame of conn.Receive()) {
+				yield await parser(frame);
+			}
+		} finally {
+			await conn.Close();
+		}
+	}
+	/** Send the client stream in the background while receiving each message of the server stream, a failure to send ends the call as soon as it happens */
+	public static async *Bidi<Req extends ProtoJSONCompatible, Res>(transport: StreamTransport, path: string, reqs: Streamable<Req>, parser: Parser<Res>): AsyncIterable<Res> {
+		let conn = await transport.Stream(path);
+		try {
+			// Never resolves, but rejects with the send error so it can be raced against each frame
+			let sendFailed = SendAll(conn, reqs).then(() => new Promise<never>(() => { }));
+			// Sending can fail after receiving has already finished, which is not an error for the call
+			sendFailed.catch(() => { });
+			let frames = conn.Receive()[Symbol.asyncIterator]();
+			while (true) {
+				let next = await Promise.race([frames.next(), sendFailed]);
+				if (next.done) {
+					// The server has closed the stream, so anything still being sent is discarded when the connection closes
+					return;
+				}
+				yield await parser(next.value);
+			}
+		} finally {
+			await conn.Close();
+		}
+	}
+}
+
+/** Send every message on the connection, then close the sending side */
+async function SendAll<T extends ProtoJSONCompatible>(conn: StreamConnection, reqs: Streamable<T>) {
+	for await (let req of reqs) {
+		await conn.Send(req.ToProtoJSON());
+	}
+	await conn.CloseSend();
+}
@@ -0,0 +1,27 @@
+/** Sends requests for generated service clients.
+ *
+ * Generated clients never make network calls themselves, they build the request path and protojson body then hand both to a transport.
+ * This allows any HTTP library to be used (axios, fetch, etc.) and makes clients trivial to test with a fake transport.
+ */
+export interface UnaryTransport {
+	/** Send a unary request, POSTing the protojson body to the httpgrpc path (e.g. "/my.package.Service/Method") and resolving with the raw response body */
+	Post(path: string, body: Object): Promise<any>;
+}
+
+/** Opens streams for the streaming methods of generated service clients, typically over a websocket */
+export interface StreamTransport {
+	/** Open a stream to the httpgrpc path (e.g. "/my.package.Service/Method") */
+	Stream(path: string): Promise<StreamConnection>;
+}
+
+/** A single open stream between client and server */
+export interface StreamConnection {
+	/** Send one protojson message, websocket implementations should pass it through JSON.stringify and send it as a single frame */
+	Send(body: Object): Promise<void>;
+	/** Signal that the client has finished sending messages */
+	CloseSend(): Promise<void>;
+	/** Receive the raw frames sent by the server (JSON strings or already parsed objects), ending when the server closes the stream */
+	Receive(): AsyncIterable<any>;
+	/** Close the stream in both directions, called exactly once when the call finishes, fails or is abandoned by the caller. Implementations should end any pending Receive and reject any pending Send */
+	Close(): Promise<void>;
+}
@@ -1,2 +1,4 @@
 export * from "./Parser";
-export * from "./ProtoJSONCompatible";
\ No newline at end of file
+export * from "./ProtoJSONCompatible";
+export * from "./Streams";
+export * from "./Transport";
\ No newline at end of file
@@ -16,54 +16,113 @@ export class Any {
 	}
 }
 
+/** Writes the fractional part of a second with 0, 3, 6 or 9 digits, as canonical protojson does */
+function FormatNanos(nanos: number): string {
+	if (nanos === 0) {
+		return "";
+	}
+	let digits = 9;
+	while (digits > 3 && nanos % 1000 === 0) {
+		nanos /= 1000;
+		digits -= 3;
+	}
+	let out = String(nanos);
+	while (out.length < digits) {
+		out = "0" + out;
+	}
+	return "." + out;
+}
+
+/** Reads the fractional part of a second, with up to 9 digits, as nanoseconds */
+function ParseNanos(fraction?: string): number {
+	return Number(((fraction ?? "") + "000000000").slice(0, 9));
+}
+
+/** A timestamp, written as an RFC 3339 string in UTC with up to nanosecond precision, e.g. "1972-01-01T10:00:20.021Z" */
 export class Timestamp {
-	constructor(ts?: Date) {
+	constructor(ts?: Date, nanos?: number) {
 		this.timestamp = ts;
+		this.nanos = nanos;
 	}
 	public timestamp?: Date;
+	/** The time of timestamp when nanos was set, nanos only describes that time */
+	private nanosTime?: number;
+	private nanosValue?: number;
+	/** The nanoseconds within the second, for timestamps more precise than Date's milliseconds. When undefined, the milliseconds of timestamp are used.
+	 * 
+	 * Nanos belong to the time timestamp held when they were set, so assigning a different time to timestamp (or changing the Date itself) discards them. Set timestamp first, then nanos.
+	 */
+	public get nanos(): number | undefined {
+		if (this.timestamp === undefined || this.timestamp.getTime() !== this.nanosTime) {
+			return undefined;
+		}
+		return this.nanosValue;
+	}
+	public set nanos(nanos: number | undefined) {
+		this.nanosTime = this.timestamp?.getTime();
+		this.nanosValue = nanos;
+	}
 	public ToProtoJSON(): string | undefined {
-		return this.timestamp?.toISOString()
+		if (this.timestamp === undefined) {
+			return undefined;
+		}
+		const nanos = this.nanos ?? this.timestamp.getUTCMilliseconds() * 1e6;
+		// toISOString is always YYYY-MM-DDTHH:mm:ss.sssZ for years 0001 to 9999, the only ones protojson allows
+		return this.timestamp.toISOString().slice(0, 19) + FormatNanos(nanos) + "Z";
 	}
 	public static async Parse(data: any): Promise<Timestamp> {
-		switch (typeof data) {
-			case "object":
-				if (!(data instanceof Date)) {
-					// TODO: handle marshalling of datetime struct
-					throw new Error("Non-date objects not supported for date parsing");
-				}
-				return new Timestamp(data);
-			case "string":
-			case "number":
-				return new Timestamp(new Date(data));
-			default:
-				throw new Error("date can only be marshalled from string or number")
+		if (data instanceof Date) {
+			return new Timestamp(data);
+		}
+		if (typeof data !== "string") {
+			throw new Error(`timestamp must be a string, found ${typeof data} instead`);
 		}
+		const match = /^(\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2})(?:\.(\d{1,9}))?(Z|[+-]\d{2}:\d{2})$/i.exec(data);
+		if (match === null) {
+			throw new Error(`invalid RFC 3339 timestamp ${data}`);
+		}
+		const nanos = ParseNanos(match[2]);
+		const millis = String(Math.floor(nanos / 1e6));
+		const ts = new Date(`${match[1]}.${"000".slice(millis.length)}${millis}${match[3].toUpperCase()}`);
+		if (isNaN(ts.getTime())) {
+			throw new Error(`invalid RFC 3339 timestamp ${data}`);
+		}
+		return new Timestamp(ts, nanos);
 	}
 }
 
+/** A span of time, written as a number of seconds with up to nanosecond precision followed by "s", e.g. "1.5s" */
 export class Duration {
 	constructor(seconds?: number) {
 		this.durationSeconds = seconds;
 	}
 	public durationSeconds?: number;
 	public ToProtoJSON(): string {
-		return (this.durationSeconds?.toFixed(9) ?? "0") + "s";
+		const total = this.durationSeconds ?? 0;
+		const abs = Math.abs(total);
+		let seconds = Math.floor(abs);
+		let nanos = Math.round((abs - seconds) * 1e9);
+		if (nanos >= 1e9) {
+			seconds += 1;
+			nanos -= 1e9;
+		}
+		const sign = total < 0 && (seconds !== 0 || nanos !== 0) ? "-" : "";
+		return `${sign}${seconds}${FormatNanos(nanos)}s`;
 	}
 	public static async Parse(data: any): Promise<Duration> {
 		if (typeof data !== "string") {
-			throw new Error("duration must be a string");
+			throw new Error(`duration must be a string, found ${typeof data} instead`);
 		}
-		if (!data.endsWith("s")) {
-			throw new Error("duration must end with s");
+		const match = /^(-)?(\d+)(?:\.(\d{1,9}))?s$/.exec(data);
+		if (match === null) {
+			throw new Error(`invalid duration ${data}`);
 		}
-		if (data.indexOf("s") !== (data.length - 1)) {
-			throw new Error("duration must only contain one s")
-		}
-		data = data.replace("s", "");
-		return new Duration(Number(data));
+		const seconds = Number(match[2]) + ParseNanos(match[3]) / 1e9;
+		return new Duration(match[1] ? -seconds : seconds);
 	}
 }
 
+/** Any JSON object */
 export class Struct {
 	constructor(data?: Object) {
 		this.data = data;
@@ -75,11 +134,14 @@ export class Struct {
 	public static async Parse(data: any): Promise<Struct> {
 		switch (typeof data) {
 			case "object":
+				if (data === null || data instanceof Array) {
+					throw new Error("struct must be an object");
+				}
 				return new Struct(data);
 			case "string":
-				return new Struct(JSON.parse(data));
+				return Struct.Parse(JSON.parse(data));
 			default:
-				throw new Error("unimplemented");
+				throw new Error(`struct must be an object, found ${typeof data} instead`);
 		}
 	}
 }
@@ -93,28 +155,45 @@ export class Wrapper {
 	}
 }
 
+/** A set of field paths, written as a single string of the paths in lowerCamelCase joined by commas, e.g. "user.displayName,photo" */
 export class FieldMask {
-	public ToProtoJSON(): any {
-		throw new Error("unimplemented");
+	constructor(paths?: string[]) {
+		this.paths = paths;
 	}
-	public static async Parse(_: any): Promise<FieldMask> {
-		throw new Error("unimplemented");
+	/** The paths using proto field names, e.g. "user.display_name" */
+	public paths?: string[];
+	public ToProtoJSON(): string | undefined {
+		return this.paths?.map(path => path.split(".").map(name => name.replace(/_([a-z0-9])/g, (_, next: string) => next.toUpperCase())).join(".")).join(",");
+	}
+	public static async Parse(data: any): Promise<FieldMask> {
+		if (typeof data !== "string") {
+			throw new Error(`field mask must be a string, found ${typeof data} instead`);
+		}
+		if (data === "") {
+			return new FieldMask([]);
+		}
+		return new FieldMask(data.split(",").map(path => path.split(".").map(name => name.replace(/[A-Z]/g, upper => "_" + upper.toLowerCase())).join(".")));
 	}
 }
 
+/** Any JSON array */
 export class ListValue {
 	constructor(data?: any[]) {
 		this.list = data;
 	}
 	public list?: any[];
-	public ToProtoJSON(): any {
-		throw new Error("unimplemented");
+	public ToProtoJSON(): any[] | undefined {
+		return this.list;
 	}
-	public static async Parse(_: any): Promise<ListValue> {
-		throw new Error("unimplemented");
+	public static async Parse(data: any): Promise<ListValue> {
+		if (!(data instanceof Array)) {
+			throw new Error("list value must be an array");
+		}
+		return new ListValue(data);
 	}
 }
 
+/** Any JSON value, including null */
 export class Value {
 	constructor(data?: any) {
 		this.value = data;
@@ -124,7 +203,7 @@ export class Value {
 		return this.value;
 	}
 	public static async Parse(data: any): Promise<Value> {
-		return data;
+		return new Value(data);
 	}
 }
 
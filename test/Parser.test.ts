@@ -0,0 +1,81 @@
+import { test } from "node:test";
+import assert from "node:assert/strict";
+import { MapKeys, Parse, ToProtoJSON } from "../src";
+
+enum Kind {
+	KIND_UNKNOWN = 0,
+	KIND_KNOWN = 1,
+}
+
+test("NonZero drops the zero value of each scalar type", () => {
+	assert.equal(ToProtoJSON.NonZero(0), undefined);
+	assert.equal(ToProtoJSON.NonZero(""), undefined);
+	assert.equal(ToProtoJSON.NonZero(false), undefined);
+	assert.equal(ToProtoJSON.NonZero(new Uint8Array(0)), undefined);
+	assert.equal(ToProtoJSON.NonZero(undefined), undefined);
+});
+
+test("NonZero keeps every other value", () => {
+	assert.equal(ToProtoJSON.NonZero(1), 1);
+	assert.equal(ToProtoJSON.NonZero(-0), -0);
+	assert.ok(Number.isNaN(ToProtoJSON.NonZero(NaN)));
+	assert.equal(ToProtoJSON.NonZero("0"), "0");
+	assert.equal(ToProtoJSON.NonZero(true), true);
+	assert.deepEqual(ToProtoJSON.NonZero(new Uint8Array([0])), new Uint8Array([0]));
+});
+
+test("Enum writes known values by name", () => {
+	assert.equal(ToProtoJSON.Enum(Kind, Kind.KIND_KNOWN), "KIND_KNOWN");
+	assert.equal(ToProtoJSON.Enum(Kind, undefined), undefined);
+});
+
+test("Open enums round trip unknown values as numbers", async () => {
+	let json = JSON.stringify({ kind: ToProtoJSON.Enum(Kind, 7) });
+	assert.equal(json, `{"kind":7}`);
+	assert.equal(await Parse.Enum(JSON.parse(json), "kind", "kind", Kind, true), 7);
+});
+
+test("Closed enums reject unknown values", async () => {
+	await assert.rejects(Parse.Enum({ kind: 7 }, "kind", "kind", Kind, false), /undefined enum value: 7/);
+	assert.equal(await Parse.Enum({ kind: "KIND_KNOWN" }, "kind", "kind", Kind, false), Kind.KIND_KNOWN);
+});
+
+test("MapKeys accept integers up to the bounds of their type", async () => {
+	assert.equal(await MapKeys.ParseInt32("-2147483648"), -2147483648);
+	assert.equal(await MapKeys.ParseInt32("2147483647"), 2147483647);
+	assert.equal(await MapKeys.ParseUint32("4294967295"), 4294967295);
+	assert.equal(await MapKeys.ParseUint32("-0"), -0);
+	assert.equal(await MapKeys.ParseInt64("-9223372036854775808"), -9223372036854775808);
+	assert.equal(await MapKeys.ParseInt64("9223372036854775807"), 9223372036854775807);
+	assert.equal(await MapKeys.ParseUint64("18446744073709551615"), 18446744073709551615);
+	assert.equal(await MapKeys.ParseInt32("007"), 7);
+});
+
+test("MapKeys reject integers beyond the bounds of their type", async () => {
+	await assert.rejects(MapKeys.ParseInt32("-2147483649"), /out of range/);
+	await assert.rejects(MapKeys.ParseInt32("2147483648"), /out of range/);
+	await assert.rejects(MapKeys.ParseUint32("4294967296"), /out of range/);
+	await assert.rejects(MapKeys.ParseUint32("-1"), /out of range/);
+	// These round to the bounds as numbers, so only a comparison of the digits catches them
+	await assert.rejects(MapKeys.ParseInt64("-9223372036854775809"), /out of range/);
+	await assert.rejects(MapKeys.ParseInt64("9223372036854775808"), /out of range/);
+	await assert.rejects(MapKeys.ParseUint64("18446744073709551616"), /out of range/);
+	await assert.rejects(MapKeys.ParseUint64("-1"), /out of range/);
+	await assert.rejects(MapKeys.ParseInt64("000000000000000000000009223372036854775808"), /out of range/);
+});
+
+test("MapKeys reject anything which isn't a decimal integer or bool", async () => {
+	for (let raw of ["", "1.5", "1e3", "0x10", " 1", "+1", "--1"]) {
+		await assert.rejects(MapKeys.ParseInt64(raw), /invalid integer map key/);
+	}
+	assert.equal(await MapKeys.ParseBool("true"), true);
+	assert.equal(await MapKeys.ParseBool("false"), false);
+	await assert.rejects(MapKeys.ParseBool("True"), /invalid bool map key/);
+});
+
+test("Map round trips keys and null values", async () => {
+	let json = JSON.parse(JSON.stringify({ values: ToProtoJSON.Map(ToProtoJSON.String, new Map<number, string | null>([[-1, "a"], [2, null]])) }));
+	assert.deepEqual(json, { values: { "-1": "a", "2": null } });
+	let parsed = await Parse.Map(json, "values", "values", MapKeys.ParseInt32, async (raw: any) => raw as string);
+	assert.deepEqual(parsed, new Map<number, string | null>([[-1, "a"], [2, null]]));
+});
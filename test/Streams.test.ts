@@ -0,0 +1,159 @@
+import { test } from "node:test";
+import assert from "node:assert/strict";
+import { MessageWriter, ProtoJSONCompatible, Stream, StreamConnection, StreamTransport } from "../src";
+
+class Message implements ProtoJSONCompatible {
+	constructor(public n: number) { }
+	public ToProtoJSON(): Object {
+		return { n: this.n };
+	}
+}
+
+const parseMessage = async (frame: any) => new Message(frame.n);
+
+/** A StreamConnection recording everything the client does, which receives the frames it was given and then either ends or waits for Close */
+class FakeConnection implements StreamConnection {
+	public sent: Object[] = [];
+	public sendClosed = false;
+	public closeCalls = 0;
+	private closed?: () => void;
+	private readonly whenClosed = new Promise<void>(resolve => this.closed = resolve);
+	constructor(private frames: any[], private options: { failSendAt?: number, endAfterFrames?: boolean } = {}) { }
+	public async Send(body: Object) {
+		if (this.sent.length === this.options.failSendAt) {
+			throw new Error("send failed");
+		}
+		this.sent.push(body);
+	}
+	public async CloseSend() {
+		this.sendClosed = true;
+	}
+	public async *Receive(): AsyncIterable<any> {
+		for (let frame of this.frames) {
+			yield frame;
+		}
+		if (this.options.endAfterFrames === false) {
+			await this.whenClosed;
+		}
+	}
+	public async Close() {
+		this.closeCalls++;
+		this.closed?.();
+	}
+}
+
+function transportFor(conn: FakeConnection): StreamTransport {
+	return { Stream: async () => conn };
+}
+
+async function collect<T>(iterable: AsyncIterable<T>): Promise<T[]> {
+	let out: T[] = [];
+	for await (let item of iterable) {
+		out.push(item);
+	}
+	return out;
+}
+
+test("Server sends the request, receives every response and closes the connection", async () => {
+	let conn = new FakeConnection([{ n: 1 }, { n: 2 }]);
+	let responses = await collect(Stream.Server(transportFor(conn), "/test.Service/Method", new Message(7), parseMessage));
+	assert.deepEqual(responses.map(res => res.n), [1, 2]);
+	assert.deepEqual(conn.sent, [{ n: 7 }]);
+	assert.equal(conn.sendClosed, true);
+	assert.equal(conn.closeCalls, 1);
+});
+
+test("Server closes the connection when the caller stops iterating early", async () => {
+	let conn = new FakeConnection([{ n: 1 }, { n: 2 }, { n: 3 }], { endAfterFrames: false });
+	for await (let res of Stream.Server(transportFor(conn), "/test.Service/Method", new Message(7), parseMessage)) {
+		assert.equal(res.n, 1);
+		break;
+	}
+	assert.equal(conn.closeCalls, 1);
+});
+
+test("Server closes the connection when parsing a response fails", async () => {
+	let conn = new FakeConnection([{ n: 1 }]);
+	let failing = async () => { throw new Error("bad response"); };
+	await assert.rejects(collect(Stream.Server(transportFor(conn), "/test.Service/Method", new Message(7), failing)), /bad response/);
+	assert.equal(conn.closeCalls, 1);
+});
+
+test("Client sends every request and resolves with the response", async () => {
+	let conn = new FakeConnection([{ n: 3 }]);
+	let res = await Stream.Client(transportFor(conn), "/test.Service/Method", [new Message(1), new Message(2)], parseMessage);
+	assert.equal(res.n, 3);
+	assert.deepEqual(conn.sent, [{ n: 1 }, { n: 2 }]);
+	assert.equal(conn.sendClosed, true);
+	assert.equal(conn.closeCalls, 1);
+});
+
+test("Client closes the connection when the server sends no response", async () => {
+	let conn = new FakeConnection([]);
+	await assert.rejects(Stream.Client(transportFor(conn), "/test.Service/Method", [new Message(1)], parseMessage), /closed without a response/);
+	assert.equal(conn.closeCalls, 1);
+});
+
+test("Client closes the connection when sending fails", async () => {
+	let conn = new FakeConnection([{ n: 3 }], { failSendAt: 1 });
+	await assert.rejects(Stream.Client(transportFor(conn), "/test.Service/Method", [new Message(1), new Message(2)], parseMessage), /send failed/);
+	assert.equal(conn.sendClosed, false);
+	assert.equal(conn.closeCalls, 1);
+});
+
+test("Bidi sends and receives at the same time", async () => {
+	let conn = new FakeConnection([{ n: 10 }, { n: 20 }]);
+	let responses = await collect(Stream.Bidi(transportFor(conn), "/test.Service/Method", [new Message(1), new Message(2)], parseMessage));
+	assert.deepEqual(responses.map(res => res.n), [10, 20]);
+	assert.equal(conn.closeCalls, 1);
+});
+
+test("Bidi ends the call as soon as sending fails", async () => {
+	// The server never ends the stream, so the call can only finish because of the send failure
+	let conn = new FakeConnection([], { failSendAt: 1, endAfterFrames: false });
+	await assert.rejects(collect(Stream.Bidi(transportFor(conn), "/test.Service/Method", [new Message(1), new Message(2)], parseMessage)), /send failed/);
+	assert.deepEqual(conn.sent, [{ n: 1 }]);
+	assert.equal(conn.closeCalls, 1);
+});
+
+test("Bidi closes the connection when the caller stops iterating early", async () => {
+	let writer = new MessageWriter<Message>();
+	let conn = new FakeConnection([{ n: 10 }, { n: 20 }], { endAfterFrames: false });
+	for await (let res of Stream.Bidi(transportFor(conn), "/test.Service/Method", writer, parseMessage)) {
+		assert.equal(res.n, 10);
+		break;
+	}
+	assert.equal(conn.closeCalls, 1);
+});
+
+test("MessageWriter yields messages sent before and after iteration starts, ending once closed", async () => {
+	let writer = new MessageWriter<number>();
+	writer.Send(1);
+	writer.Send(2);
+	let received = collect(writer);
+	writer.Send(3);
+	await Promise.resolve();
+	writer.Send(4);
+	writer.Close();
+	assert.deepEqual(await received, [1, 2, 3, 4]);
+});
+
+test("MessageWriter sends queued messages after Close and rejects new ones", async () => {
+	let writer = new MessageWriter<number>();
+	writer.Send(1);
+	writer.Close();
+	assert.throws(() => writer.Send(2), /closed MessageWriter/);
+	assert.deepEqual(await collect(writer), [1]);
+});
+
+test("MessageWriter streams to a client call as messages are written", async () => {
+	let writer = new MessageWriter<Message>();
+	let conn = new FakeConnection([{ n: 3 }]);
+	let res = Stream.Client(transportFor(conn), "/test.Service/Method", writer, parseMessage);
+	writer.Send(new Message(1));
+	writer.Send(new Message(2));
+	writer.Close();
+	assert.equal((await res).n, 3);
+	assert.deepEqual(conn.sent, [{ n: 1 }, { n: 2 }]);
+	assert.equal(conn.closeCalls, 1);
+});
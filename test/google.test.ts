@@ -0,0 +1,58 @@
+import { test } from "node:test";
+import assert from "node:assert/strict";
+import { google } from "../src";
+
+test("Timestamp round trips every precision", async () => {
+	for (let text of ["1972-01-01T10:00:20Z", "1972-01-01T10:00:20.021Z", "1972-01-01T10:00:20.000021Z", "1972-01-01T10:00:20.123456789Z"]) {
+		assert.equal((await google.protobuf.Timestamp.Parse(text)).ToProtoJSON(), text);
+	}
+});
+
+test("Timestamp normalises offsets and fraction lengths", async () => {
+	assert.equal((await google.protobuf.Timestamp.Parse("1972-01-01T12:00:20.5+02:00")).ToProtoJSON(), "1972-01-01T10:00:20.500Z");
+	await assert.rejects(google.protobuf.Timestamp.Parse("1972-01-01 10:00:20Z"), /invalid RFC 3339 timestamp/);
+	await assert.rejects(google.protobuf.Timestamp.Parse(5), /timestamp must be a string/);
+});
+
+test("Timestamp nanos are discarded when the timestamp changes", async () => {
+	let ts = await google.protobuf.Timestamp.Parse("1972-01-01T10:00:20.123456789Z");
+	ts.timestamp = new Date("2000-01-01T00:00:00.500Z");
+	assert.equal(ts.nanos, undefined);
+	assert.equal(ts.ToProtoJSON(), "2000-01-01T00:00:00.500Z");
+
+	ts = await google.protobuf.Timestamp.Parse("1972-01-01T10:00:20.123456789Z");
+	ts.timestamp?.setUTCFullYear(1980);
+	assert.equal(ts.ToProtoJSON(), "1980-01-01T10:00:20.123Z");
+});
+
+test("Timestamp nanos set after the timestamp are kept", () => {
+	let ts = new google.protobuf.Timestamp();
+	ts.timestamp = new Date("2000-01-01T00:00:00.123Z");
+	ts.nanos = 123456000;
+	assert.equal(ts.ToProtoJSON(), "2000-01-01T00:00:00.123456Z");
+	assert.equal(new google.protobuf.Timestamp(new Date("2000-01-01T00:00:00Z"), 1).ToProtoJSON(), "2000-01-01T00:00:00.000000001Z");
+});
+
+test("Duration round trips", async () => {
+	for (let text of ["0s", "1s", "-1.500s", "0.000000001s", "86400.000001s"]) {
+		assert.equal((await google.protobuf.Duration.Parse(text)).ToProtoJSON(), text);
+	}
+	assert.equal(new google.protobuf.Duration(-0.25).ToProtoJSON(), "-0.250s");
+	await assert.rejects(google.protobuf.Duration.Parse("1m"), /invalid duration/);
+});
+
+test("FieldMask converts between proto field names and lowerCamelCase", async () => {
+	let mask = await google.protobuf.FieldMask.Parse("user.displayName,photo");
+	assert.deepEqual(mask.paths, ["user.display_name", "photo"]);
+	assert.equal(mask.ToProtoJSON(), "user.displayName,photo");
+	assert.deepEqual((await google.protobuf.FieldMask.Parse("")).paths, []);
+});
+
+test("Struct, ListValue and Value hold JSON", async () => {
+	assert.deepEqual((await google.protobuf.Struct.Parse({ a: [1, null] })).ToProtoJSON(), { a: [1, null] });
+	await assert.rejects(google.protobuf.Struct.Parse([1]), /struct must be an object/);
+	assert.deepEqual((await google.protobuf.ListValue.Parse([1, "a"])).ToProtoJSON(), [1, "a"]);
+	await assert.rejects(google.protobuf.ListValue.Parse({}), /list value must be an array/);
+	assert.equal((await google.protobuf.Value.Parse(null)).ToProtoJSON(), null);
+	assert.deepEqual(new google.protobuf.Empty().ToProtoJSON(), {});
+});
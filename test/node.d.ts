@@ -0,0 +1,17 @@
+// The parts of node's built in test runner used by the tests, declared here rather than depending on @types/node, which needs a newer typescript than the package supports
+
+declare module "node:test" {
+	export function test(name: string, fn: () => void | Promise<void>): Promise<void>;
+}
+
+declare module "node:assert/strict" {
+	function assert(value: unknown, message?: string): asserts value;
+	namespace assert {
+		function ok(value: unknown, message?: string): asserts value;
+		function equal(actual: unknown, expected: unknown, message?: string): void;
+		function deepEqual(actual: unknown, expected: unknown, message?: string): void;
+		function throws(fn: () => unknown, error?: RegExp, message?: string): void;
+		function rejects(promise: Promise<unknown> | (() => Promise<unknown>), error?: RegExp, message?: string): Promise<void>;
+	}
+	export = assert;
+}